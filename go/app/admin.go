@@ -0,0 +1,95 @@
+package app
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// This file defines the endpoints to operate the running server, such as changing the log level.
+// They're registered only if Server.AdminToken is set, and require it as a bearer token:
+//
+//	curl -X PUT -H "Authorization: Bearer $ADMIN_TOKEN" -d '{"level": "debug"}' http://localhost:9000/admin/log-level
+
+// minAdminTokenLength is the minimum length of Server.AdminToken, so that it can't be guessed.
+const minAdminTokenLength = 16
+
+// logLevels are the levels which can be set by PUT /admin/log-level .
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+var errUnauthorized = errors.New("a valid admin token is required")
+
+// LogLevelV1 is the log level returned and set by /admin/log-level in version 1 of the API.
+type LogLevelV1 struct {
+	Level string `json:"level"`
+}
+
+// requireAdmin rejects the requests without the admin token.
+func (s *Handlers) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || s.adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, r, &apiError{Code: codeUnauthorized, Err: errUnauthorized})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// GetLogLevel is a handler to return the current log level for GET /admin/log-level .
+func (s *Handlers) GetLogLevel(w http.ResponseWriter, r *http.Request) {
+	if err := json.NewEncoder(w).Encode(newLogLevelV1(s.logLevel.Level())); err != nil {
+		writeError(w, r, err)
+		return
+	}
+}
+
+func parseSetLogLevelRequest(r *http.Request) (slog.Level, error) {
+	var req LogLevelV1
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		return 0, fmt.Errorf("failed to decode request body: %w", bodyError(r, err))
+	}
+
+	// validate the request
+	req.Level = strings.ToLower(strings.TrimSpace(req.Level))
+	v := &validator{}
+	v.check("level", req.Level, required, oneOf(logLevels...))
+	if err := v.err(); err != nil {
+		return 0, err
+	}
+
+	var level slog.Level
+	err := level.UnmarshalText([]byte(req.Level))
+	return level, err
+}
+
+// SetLogLevel is a handler to change the log level for PUT /admin/log-level .
+// The level is kept until the server is restarted.
+func (s *Handlers) SetLogLevel(w http.ResponseWriter, r *http.Request) {
+	level, err := parseSetLogLevelRequest(r)
+	if err != nil {
+		slog.WarnContext(r.Context(), "failed to parse set log level request: ", "error", err)
+		writeError(w, r, validationError(err))
+		return
+	}
+
+	// logged before the change, so that it isn't hidden when the level is raised
+	slog.WarnContext(r.Context(), "changing log level", "from", s.logLevel.Level(), "to", level)
+	s.logLevel.Set(level)
+
+	if err := json.NewEncoder(w).Encode(newLogLevelV1(level)); err != nil {
+		writeError(w, r, err)
+		return
+	}
+}
+
+func newLogLevelV1(level slog.Level) LogLevelV1 {
+	return LogLevelV1{Level: strings.ToLower(level.String())}
+}
@@ -0,0 +1,128 @@
+package app
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	t.Parallel()
+
+	const token = "0123456789abcdef"
+	cases := map[string]struct {
+		adminToken    string
+		authorization string
+		code          int
+	}{
+		"ok: valid token": {
+			adminToken:    token,
+			authorization: "Bearer " + token,
+			code:          http.StatusOK,
+		},
+		"ng: no token": {
+			adminToken: token,
+			code:       http.StatusUnauthorized,
+		},
+		"ng: wrong token": {
+			adminToken:    token,
+			authorization: "Bearer fedcba9876543210",
+			code:          http.StatusUnauthorized,
+		},
+		"ng: not a bearer token": {
+			adminToken:    token,
+			authorization: "Basic " + token,
+			code:          http.StatusUnauthorized,
+		},
+		"ng: admin token isn't set": {
+			authorization: "Bearer ",
+			code:          http.StatusUnauthorized,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			h := &Handlers{adminToken: tt.adminToken}
+			handler := h.requireAdmin(func(w http.ResponseWriter, r *http.Request) {})
+
+			req := httptest.NewRequest("GET", "/admin/log-level", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+
+			if rr.Code != tt.code {
+				t.Errorf("expected status code %d, got %d", tt.code, rr.Code)
+			}
+		})
+	}
+}
+
+func TestSetLogLevel(t *testing.T) {
+	t.Parallel()
+
+	type wants struct {
+		code  int
+		level slog.Level
+	}
+	cases := map[string]struct {
+		body string
+		wants
+	}{
+		"ok: debug": {
+			body:  `{"level": "debug"}`,
+			wants: wants{code: http.StatusOK, level: slog.LevelDebug},
+		},
+		"ok: upper case": {
+			body:  `{"level": "ERROR"}`,
+			wants: wants{code: http.StatusOK, level: slog.LevelError},
+		},
+		"ng: unknown level": {
+			body:  `{"level": "verbose"}`,
+			wants: wants{code: http.StatusBadRequest, level: slog.LevelInfo},
+		},
+		"ng: empty level": {
+			body:  `{}`,
+			wants: wants{code: http.StatusBadRequest, level: slog.LevelInfo},
+		},
+		"ng: unknown field": {
+			body:  `{"level": "debug", "logger": "infra"}`,
+			wants: wants{code: http.StatusBadRequest, level: slog.LevelInfo},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			h := &Handlers{logLevel: new(slog.LevelVar)}
+			req := httptest.NewRequest("PUT", "/admin/log-level", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			h.SetLogLevel(rr, req)
+
+			if rr.Code != tt.wants.code {
+				t.Errorf("expected status code %d, got %d: %s", tt.wants.code, rr.Code, rr.Body.String())
+			}
+			if got := h.logLevel.Level(); got != tt.wants.level {
+				t.Errorf("expected level %v, got %v", tt.wants.level, got)
+			}
+
+			// the level set is returned by GET /admin/log-level
+			rr = httptest.NewRecorder()
+			h.GetLogLevel(rr, httptest.NewRequest("GET", "/admin/log-level", nil))
+			var got LogLevelV1
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if want := newLogLevelV1(tt.wants.level); got != want {
+				t.Errorf("expected %+v, got %+v", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,430 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// This file loads the configuration of the server.
+// Each setting is read from, in order of precedence, a command-line flag, an environment variable,
+// a config file (YAML or TOML) and the default. A setting with the key "image_gc_interval" is set by
+// the flag -image-gc-interval, the environment variable IMAGE_GC_INTERVAL and the key image_gc_interval in the file.
+
+// Config is the configuration of the server.
+type Config struct {
+	Port     string `yaml:"port" toml:"port"`
+	ImageDir string `yaml:"image_dir" toml:"image_dir"`
+	DBPath   string `yaml:"db_path" toml:"db_path"`
+	// LogLevel is one of "debug", "info", "warn" and "error".
+	LogLevel string `yaml:"log_level" toml:"log_level"`
+	// LogFormat is either "json" or "text".
+	LogFormat string `yaml:"log_format" toml:"log_format"`
+	// AdminToken enables the endpoints under /admin/ such as PUT /admin/log-level .
+	AdminToken string `yaml:"admin_token" toml:"admin_token"`
+	// CORSOrigins are the origins allowed to call the API from browsers. "*" allows any origin.
+	CORSOrigins []string `yaml:"cors_origins" toml:"cors_origins"`
+	// Categories are the categories items can have. Any category is allowed if empty.
+	Categories []string `yaml:"item_categories" toml:"item_categories"`
+
+	ImageBackend    string        `yaml:"image_backend" toml:"image_backend"`
+	ImageTypes      []string      `yaml:"image_types" toml:"image_types"`
+	ImageGCInterval time.Duration `yaml:"image_gc_interval" toml:"image_gc_interval"`
+	ImageGCGrace    time.Duration `yaml:"image_gc_grace" toml:"image_gc_grace"`
+	ImageUploadTTL  time.Duration `yaml:"image_upload_ttl" toml:"image_upload_ttl"`
+	MaxBodyBytes    int64         `yaml:"max_body_bytes" toml:"max_body_bytes"`
+	MaxImageBytes   int64         `yaml:"max_image_bytes" toml:"max_image_bytes"`
+
+	S3Endpoint  string `yaml:"s3_endpoint" toml:"s3_endpoint"`
+	S3Bucket    string `yaml:"s3_bucket" toml:"s3_bucket"`
+	S3Region    string `yaml:"s3_region" toml:"s3_region"`
+	S3AccessKey string `yaml:"s3_access_key" toml:"s3_access_key"`
+	S3SecretKey string `yaml:"s3_secret_key" toml:"s3_secret_key"`
+	S3UseSSL    bool   `yaml:"s3_use_ssl" toml:"s3_use_ssl"`
+
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+
+	TraceExporter string `yaml:"trace_exporter" toml:"trace_exporter"`
+	OTLPEndpoint  string `yaml:"otlp_endpoint" toml:"otlp_endpoint"`
+}
+
+// DefaultConfig returns the configuration used when nothing is set.
+func DefaultConfig() *Config {
+	return &Config{
+		Port:              "9000",
+		ImageDir:          "images",
+		DBPath:            "db/mercari.sqlite3",
+		LogLevel:          "info",
+		LogFormat:         LogFormatJSON,
+		CORSOrigins:       []string{"http://localhost:3000"},
+		ImageBackend:      ImageBackendLocal,
+		ImageGCGrace:      DefaultImageGCGrace,
+		ImageUploadTTL:    DefaultImageUploadTTL,
+		MaxBodyBytes:      DefaultMaxBodyBytes,
+		MaxImageBytes:     DefaultMaxImageBytes,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       2 * time.Minute,
+		WriteTimeout:      2 * time.Minute,
+		IdleTimeout:       2 * time.Minute,
+		ShutdownTimeout:   DefaultShutdownTimeout,
+		TraceExporter:     TraceExporterNone,
+		OTLPEndpoint:      DefaultOTLPEndpoint,
+	}
+}
+
+// setting is a setting of Config which can be set by a flag or an environment variable.
+type setting struct {
+	key   string
+	usage string
+	// value points to the field of Config.
+	value any
+	// aliases are the other environment variables to read, which are kept for compatibility.
+	aliases []string
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{key: "port", usage: "port number to listen on", value: &c.Port},
+		{key: "image_dir", usage: "directory storing images for the local image backend", value: &c.ImageDir},
+		{key: "db_path", usage: "path to the SQLite database file", value: &c.DBPath},
+		{key: "log_level", usage: "log level: debug, info, warn or error", value: &c.LogLevel},
+		{key: "log_format", usage: "log format: json or text", value: &c.LogFormat},
+		{key: "admin_token", usage: "bearer token of the endpoints under /admin/ (disabled if empty)", value: &c.AdminToken},
+		{key: "cors_origins", usage: "comma-separated origins allowed by CORS, or * for any origin", value: &c.CORSOrigins, aliases: []string{"FRONT_URL"}},
+		{key: "item_categories", usage: "comma-separated categories items can have (any if empty)", value: &c.Categories},
+		{key: "image_backend", usage: "where images are stored: local or s3", value: &c.ImageBackend},
+		{key: "image_types", usage: "comma-separated media types of the images accepted (all supported if empty)", value: &c.ImageTypes},
+		{key: "image_gc_interval", usage: "interval to remove unreferenced images (disabled if 0)", value: &c.ImageGCInterval},
+		{key: "image_gc_grace", usage: "time an unreferenced image is kept after it was stored", value: &c.ImageGCGrace},
+		{key: "image_upload_ttl", usage: "time an image uploaded with POST /images can be referenced", value: &c.ImageUploadTTL},
+		{key: "max_body_bytes", usage: "maximum size of a request body with images", value: &c.MaxBodyBytes},
+		{key: "max_image_bytes", usage: "maximum size of an uploaded image", value: &c.MaxImageBytes},
+		{key: "s3_endpoint", usage: "host (and port) of the S3-compatible storage", value: &c.S3Endpoint},
+		{key: "s3_bucket", usage: "bucket storing images", value: &c.S3Bucket},
+		{key: "s3_region", usage: "region of the bucket", value: &c.S3Region},
+		{key: "s3_access_key", usage: "access key of the storage", value: &c.S3AccessKey},
+		{key: "s3_secret_key", usage: "secret key of the storage", value: &c.S3SecretKey},
+		{key: "s3_use_ssl", usage: "connect to the storage with HTTPS", value: &c.S3UseSSL},
+		{key: "read_header_timeout", usage: "time to read the headers of a request", value: &c.ReadHeaderTimeout},
+		{key: "read_timeout", usage: "time to read a whole request including the body", value: &c.ReadTimeout},
+		{key: "write_timeout", usage: "time to write a response after the request headers are read", value: &c.WriteTimeout},
+		{key: "idle_timeout", usage: "time to keep an idle connection", value: &c.IdleTimeout},
+		{key: "shutdown_timeout", usage: "time to wait for the requests in progress when the server is stopped", value: &c.ShutdownTimeout},
+		{key: "trace_exporter", usage: "where the spans of requests are exported: none, stdout or otlp", value: &c.TraceExporter},
+		{key: "otlp_endpoint", usage: "URL of the OpenTelemetry collector receiving spans over OTLP/HTTP", value: &c.OTLPEndpoint},
+	}
+}
+
+// flagName returns the name of the flag of the setting, e.g. "image-dir".
+func (s setting) flagName() string {
+	return strings.ReplaceAll(s.key, "_", "-")
+}
+
+// envNames returns the environment variables of the setting in order of precedence, e.g. "IMAGE_DIR".
+func (s setting) envNames() []string {
+	return append([]string{strings.ToUpper(s.key)}, s.aliases...)
+}
+
+// set parses a string into the field of the setting.
+func (s setting) set(v string) error {
+	var err error
+	switch p := s.value.(type) {
+	case *string:
+		*p = v
+	case *[]string:
+		*p = nil
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*p = append(*p, item)
+			}
+		}
+	case *int64:
+		*p, err = strconv.ParseInt(v, 10, 64)
+	case *bool:
+		*p, err = strconv.ParseBool(v)
+	case *time.Duration:
+		*p, err = time.ParseDuration(v)
+	default:
+		panic(fmt.Sprintf("unsupported type of setting %s: %T", s.key, s.value))
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %w", s.key, v, err)
+	}
+	return nil
+}
+
+// String formats the field of the setting as set parses it.
+func (s setting) String() string {
+	switch p := s.value.(type) {
+	case *string:
+		return *p
+	case *[]string:
+		return strings.Join(*p, ",")
+	case *int64:
+		return strconv.FormatInt(*p, 10)
+	case *bool:
+		return strconv.FormatBool(*p)
+	case *time.Duration:
+		return p.String()
+	default:
+		panic(fmt.Sprintf("unsupported type of setting %s: %T", s.key, s.value))
+	}
+}
+
+// LoadOptions are the options of the loading of a Config which aren't settings.
+type LoadOptions struct {
+	// File is the path to the config file read, or "" if none is read.
+	File string
+	// PrintConfig tells to print the config and exit instead of running the server.
+	PrintConfig bool
+}
+
+// LoadConfig loads a Config from the command-line arguments args, the environment variables read by lookupEnv,
+// and the config file set by the flag -config or the environment variable CONFIG_FILE.
+// The config file is YAML, or TOML if the file name ends with .toml .
+// It returns flag.ErrHelp if -help is given.
+func LoadConfig(name string, args []string, lookupEnv func(string) (string, bool)) (*Config, *LoadOptions, error) {
+	cfg := DefaultConfig()
+	settings := cfg.settings()
+
+	// the flags are parsed first to find the config file, but applied last
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	opts := &LoadOptions{}
+	fs.StringVar(&opts.File, "config", "", "path to the config file (YAML, or TOML with the .toml extension)")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "print the config and exit")
+	for _, s := range settings {
+		fs.String(s.flagName(), s.String(), s.usage+" (env "+s.envNames()[0]+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, nil, fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+
+	if opts.File == "" {
+		opts.File, _ = lookupEnv("CONFIG_FILE")
+	}
+	if opts.File != "" {
+		if err := cfg.readFile(opts.File); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var errs []error
+	for _, s := range settings {
+		for _, env := range s.envNames() {
+			if v, ok := lookupEnv(env); ok && v != "" {
+				errs = append(errs, s.set(v))
+				break
+			}
+		}
+	}
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flagName() == f.Name {
+				errs = append(errs, s.set(f.Value.String()))
+			}
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return nil, nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, opts, nil
+}
+
+// readFile reads the settings in a config file into c. The settings not in the file are kept.
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if filepath.Ext(path) == ".toml" {
+		md, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("failed to parse config file %s: unknown keys %v", path, undecoded)
+		}
+		return nil
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate checks that the settings are valid, and returns all the invalid ones.
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("invalid %s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		invalid("port", "%q is not a port number", c.Port)
+	}
+	if c.DBPath == "" {
+		invalid("db_path", "must not be empty")
+	}
+	if _, err := c.SlogLevel(); err != nil {
+		invalid("log_level", "%q is not one of debug, info, warn and error", c.LogLevel)
+	}
+	if c.LogFormat != LogFormatJSON && c.LogFormat != LogFormatText {
+		invalid("log_format", "%q is not one of json and text", c.LogFormat)
+	}
+	if c.AdminToken != "" && len(c.AdminToken) < minAdminTokenLength {
+		invalid("admin_token", "must be at least %d characters", minAdminTokenLength)
+	}
+	for _, origin := range c.CORSOrigins {
+		if origin == "*" {
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			invalid("cors_origins", "%q is not an origin such as http://localhost:3000", origin)
+		}
+	}
+
+	switch c.ImageBackend {
+	case ImageBackendLocal:
+		if c.ImageDir == "" {
+			invalid("image_dir", "must not be empty for the local image backend")
+		}
+	case ImageBackendS3:
+		if c.S3Endpoint == "" || c.S3Bucket == "" {
+			invalid("image_backend", "s3_endpoint and s3_bucket must be set for the s3 image backend")
+		}
+	default:
+		invalid("image_backend", "%q is not one of local and s3", c.ImageBackend)
+	}
+	for _, t := range c.ImageTypes {
+		if !slices.Contains(DefaultImageTypes, t) {
+			invalid("image_types", "%q is not one of %s", t, strings.Join(DefaultImageTypes, ", "))
+		}
+	}
+	switch c.TraceExporter {
+	case TraceExporterNone, TraceExporterStdout:
+	case TraceExporterOTLP:
+		if u, err := url.Parse(c.OTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("otlp_endpoint", "%q is not a URL such as %s", c.OTLPEndpoint, DefaultOTLPEndpoint)
+		}
+	default:
+		invalid("trace_exporter", "%q is not one of none, stdout and otlp", c.TraceExporter)
+	}
+	if c.MaxBodyBytes <= 0 {
+		invalid("max_body_bytes", "must be positive")
+	}
+	if c.MaxImageBytes <= 0 || c.MaxImageBytes > c.MaxBodyBytes {
+		invalid("max_image_bytes", "must be positive and not larger than max_body_bytes")
+	}
+
+	for _, d := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"image_gc_interval", c.ImageGCInterval},
+		{"image_gc_grace", c.ImageGCGrace},
+		{"image_upload_ttl", c.ImageUploadTTL},
+		{"read_header_timeout", c.ReadHeaderTimeout},
+		{"read_timeout", c.ReadTimeout},
+		{"write_timeout", c.WriteTimeout},
+		{"idle_timeout", c.IdleTimeout},
+		{"shutdown_timeout", c.ShutdownTimeout},
+	} {
+		if d.value < 0 {
+			invalid(d.key, "must not be negative")
+		}
+	}
+	if c.ImageUploadTTL == 0 {
+		invalid("image_upload_ttl", "must be positive")
+	}
+
+	return errors.Join(errs...)
+}
+
+// SlogLevel returns the LogLevel as a slog.Level.
+func (c *Config) SlogLevel() (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(c.LogLevel))
+	return level, err
+}
+
+// Print writes the config as YAML, which can be used as a config file. Secrets are masked.
+func (c *Config) Print(w io.Writer) error {
+	masked := *c
+	if masked.S3SecretKey != "" {
+		masked.S3SecretKey = "********"
+	}
+	if masked.AdminToken != "" {
+		masked.AdminToken = "********"
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&masked); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// Server returns the Server configured by c.
+func (c *Config) Server() Server {
+	level, _ := c.SlogLevel()
+	return Server{
+		Port:         c.Port,
+		ImageDirPath: c.ImageDir,
+		DBPath:       c.DBPath,
+		LogLevel:     level,
+		LogFormat:    c.LogFormat,
+		AdminToken:   c.AdminToken,
+		CORSOrigins:  c.CORSOrigins,
+		ImageBackend: c.ImageBackend,
+		S3: S3Config{
+			Endpoint:  c.S3Endpoint,
+			Bucket:    c.S3Bucket,
+			Region:    c.S3Region,
+			AccessKey: c.S3AccessKey,
+			SecretKey: c.S3SecretKey,
+			UseSSL:    c.S3UseSSL,
+		},
+		ImageTypes:        c.ImageTypes,
+		ImageGCInterval:   c.ImageGCInterval,
+		ImageGCGrace:      c.ImageGCGrace,
+		MaxBodyBytes:      c.MaxBodyBytes,
+		MaxImageBytes:     c.MaxImageBytes,
+		Categories:        c.Categories,
+		ImageUploadTTL:    c.ImageUploadTTL,
+		ReadHeaderTimeout: c.ReadHeaderTimeout,
+		ReadTimeout:       c.ReadTimeout,
+		WriteTimeout:      c.WriteTimeout,
+		IdleTimeout:       c.IdleTimeout,
+		ShutdownTimeout:   c.ShutdownTimeout,
+		TraceExporter:     c.TraceExporter,
+		OTLPEndpoint:      c.OTLPEndpoint,
+	}
+}
@@ -0,0 +1,171 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestLoadConfig(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(yamlFile, []byte("port: \"8000\"\nlog_level: debug\nimage_gc_interval: 1h\ncors_origins: [http://a.example]\n"), 0o644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	tomlFile := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(tomlFile, []byte("port = \"8000\"\nmax_image_bytes = 1000\n"), 0o644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	unknownFile := filepath.Join(dir, "unknown.yaml")
+	if err := os.WriteFile(unknownFile, []byte("prot: \"8000\"\n"), 0o644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	cases := map[string]struct {
+		args   []string
+		env    map[string]string
+		modify func(c *Config)
+		err    bool
+	}{
+		"ok: defaults": {
+			modify: func(c *Config) {},
+		},
+		"ok: flags take precedence over env and the file": {
+			args: []string{"-config", yamlFile, "-port", "7000"},
+			env:  map[string]string{"PORT": "7500", "LOG_LEVEL": "warn"},
+			modify: func(c *Config) {
+				c.Port = "7000"
+				c.LogLevel = "warn"
+				c.ImageGCInterval = time.Hour
+				c.CORSOrigins = []string{"http://a.example"}
+			},
+		},
+		"ok: config file from env": {
+			env: map[string]string{"CONFIG_FILE": tomlFile},
+			modify: func(c *Config) {
+				c.Port = "8000"
+				c.MaxImageBytes = 1000
+			},
+		},
+		"ok: lists and compatible env": {
+			args: []string{"--image-types", "image/png, image/jpeg"},
+			env:  map[string]string{"FRONT_URL": "http://b.example"},
+			modify: func(c *Config) {
+				c.ImageTypes = []string{"image/png", "image/jpeg"}
+				c.CORSOrigins = []string{"http://b.example"}
+			},
+		},
+		"ok: otlp exporter": {
+			env: map[string]string{"TRACE_EXPORTER": "otlp", "OTLP_ENDPOINT": "https://collector.example:4318"},
+			modify: func(c *Config) {
+				c.TraceExporter = TraceExporterOTLP
+				c.OTLPEndpoint = "https://collector.example:4318"
+			},
+		},
+		"ok: text logs and admin endpoints": {
+			env: map[string]string{"LOG_FORMAT": "text", "ADMIN_TOKEN": "0123456789abcdef"},
+			modify: func(c *Config) {
+				c.LogFormat = LogFormatText
+				c.AdminToken = "0123456789abcdef"
+			},
+		},
+		"ng: short admin token": {
+			env: map[string]string{"ADMIN_TOKEN": "admin"},
+			err: true,
+		},
+		"ng: otlp endpoint without scheme": {
+			args: []string{"-trace-exporter", "otlp", "-otlp-endpoint", "localhost:4318"},
+			err:  true,
+		},
+		"ng: unknown key in the file": {
+			args: []string{"-config", unknownFile},
+			err:  true,
+		},
+		"ng: malformed duration": {
+			env: map[string]string{"IMAGE_GC_GRACE": "1 day"},
+			err: true,
+		},
+		"ng: invalid settings": {
+			args: []string{"-port", "0", "-cors-origins", "localhost:3000", "-image-types", "image/bmp"},
+			err:  true,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			lookupEnv := func(key string) (string, bool) {
+				v, ok := tt.env[key]
+				return v, ok
+			}
+			got, _, err := LoadConfig("api", tt.args, lookupEnv)
+			if err != nil {
+				if !tt.err {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if tt.err {
+				t.Fatalf("expected an error, got %+v", got)
+			}
+
+			want := DefaultConfig()
+			tt.modify(want)
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("unexpected config (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLoadConfigHelp(t *testing.T) {
+	t.Parallel()
+
+	_, _, err := LoadConfig("api", []string{"-help"}, func(string) (string, bool) { return "", false })
+	if !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("expected flag.ErrHelp, got %v", err)
+	}
+}
+
+func TestConfigPrint(t *testing.T) {
+	t.Parallel()
+
+	cfg := DefaultConfig()
+	cfg.S3SecretKey = "p4ssw0rd"
+	cfg.AdminToken = "0123456789abcdef"
+	var b bytes.Buffer
+	if err := cfg.Print(&b); err != nil {
+		t.Fatalf("failed to print config: %v", err)
+	}
+	for _, secret := range []string{"p4ssw0rd", "0123456789abcdef"} {
+		if strings.Contains(b.String(), secret) {
+			t.Errorf("the secret %s is printed: %s", secret, b.String())
+		}
+	}
+
+	// the printed config can be read as a config file
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, b.Bytes(), 0o644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	got := DefaultConfig()
+	if err := got.readFile(file); err != nil {
+		t.Fatalf("failed to read printed config: %v", err)
+	}
+	cfg.S3SecretKey = "********"
+	cfg.AdminToken = "********"
+	if diff := cmp.Diff(cfg, got, cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("unexpected config (-want +got):\n%s", diff)
+	}
+}
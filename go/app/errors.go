@@ -0,0 +1,131 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// This file defines the errors returned to clients.
+// Errors are written as problem details (RFC 7807) with a code, so that clients can tell them apart
+// without parsing the messages, and internal errors such as SQL errors aren't sent to clients as they are.
+
+// errorCode is the kind of an error returned to clients.
+type errorCode string
+
+const (
+	codeValidation       errorCode = "validation_error"
+	codeUnauthorized     errorCode = "unauthorized"
+	codeNotFound         errorCode = "not_found"
+	codeConflict         errorCode = "conflict"
+	codeUnsupportedMedia errorCode = "unsupported_media_type"
+	codePayloadTooLarge  errorCode = "payload_too_large"
+	codeInternal         errorCode = "internal_error"
+)
+
+// errorStatuses are the HTTP statuses of the error codes.
+var errorStatuses = map[errorCode]int{
+	codeValidation:       http.StatusBadRequest,
+	codeUnauthorized:     http.StatusUnauthorized,
+	codeNotFound:         http.StatusNotFound,
+	codeConflict:         http.StatusConflict,
+	codeUnsupportedMedia: http.StatusUnsupportedMediaType,
+	codePayloadTooLarge:  http.StatusRequestEntityTooLarge,
+	codeInternal:         http.StatusInternalServerError,
+}
+
+// apiError is an error with the code and the message returned to clients.
+type apiError struct {
+	Code errorCode
+	// Err is the cause of the error. Its message is returned to clients unless the code is codeInternal.
+	Err error
+}
+
+func (e *apiError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *apiError) Unwrap() error {
+	return e.Err
+}
+
+// validationError marks an error as an error of invalid request, unless it already has a code.
+func validationError(err error) error {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return err
+	}
+	return &apiError{Code: codeValidation, Err: err}
+}
+
+// internalError marks an error as an internal error, which isn't turned into a validation error by validationError.
+func internalError(err error) error {
+	return &apiError{Code: codeInternal, Err: err}
+}
+
+// Problem is the body of an error response, which is an RFC 7807 problem details object.
+type Problem struct {
+	Type     string    `json:"type"`
+	Title    string    `json:"title"`
+	Status   int       `json:"status"`
+	Detail   string    `json:"detail"`
+	Instance string    `json:"instance,omitempty"`
+	Code     errorCode `json:"code"`
+	// Errors are the fields failing the validation for codeValidation.
+	Errors []FieldError `json:"errors,omitempty"`
+	// Target and LimitBytes are set for codePayloadTooLarge.
+	Target     string `json:"target,omitempty"`
+	LimitBytes int64  `json:"limit_bytes,omitempty"`
+}
+
+// newProblem converts an error into the problem details returned to clients.
+// Errors which aren't known to be caused by the request are internal errors, and their messages are hidden.
+func newProblem(r *http.Request, err error) *Problem {
+	p := &Problem{Type: "about:blank", Instance: r.URL.Path, Code: codeInternal}
+
+	var apiErr *apiError
+	var tooLarge *tooLargeError
+	var fieldErrs fieldErrors
+	switch {
+	case errors.As(err, &fieldErrs):
+		p.Code = codeValidation
+		p.Errors = fieldErrs
+	case errors.As(err, &tooLarge):
+		p.Code = codePayloadTooLarge
+		p.Target = tooLarge.Target
+		p.LimitBytes = tooLarge.Limit
+	case errors.As(err, &apiErr):
+		p.Code = apiErr.Code
+	case errors.Is(err, errItemNotFound), errors.Is(err, errImageNotFound):
+		p.Code = codeNotFound
+	case errors.Is(err, errConflict):
+		p.Code = codeConflict
+	case errors.Is(err, errInvalidCursor), errors.Is(err, errInvalidSearchQuery):
+		p.Code = codeValidation
+	case errors.Is(err, errUnsupportedImage):
+		p.Code = codeUnsupportedMedia
+	case errors.Is(err, errImageTooLarge):
+		p.Code = codePayloadTooLarge
+	}
+
+	p.Status = errorStatuses[p.Code]
+	p.Title = http.StatusText(p.Status)
+	if p.Code == codeInternal {
+		p.Detail = "an internal error occurred"
+	} else {
+		p.Detail = err.Error()
+	}
+	return p
+}
+
+// writeError writes an error response as application/problem+json.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	p := newProblem(r, err)
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		slog.ErrorContext(r.Context(), "failed to write error response: ", "error", err)
+	}
+}
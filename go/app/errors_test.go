@@ -0,0 +1,78 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteError(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		err  error
+		want Problem
+	}{
+		"validation error": {
+			err:  validationError(errors.New("name is required")),
+			want: Problem{Type: "about:blank", Title: "Bad Request", Status: http.StatusBadRequest, Detail: "name is required", Instance: "/items", Code: codeValidation},
+		},
+		"invalid fields": {
+			err:  validationError(fieldErrors{{Field: "name", Message: "is required"}, {Field: "category", Message: "is required"}}),
+			want: Problem{Type: "about:blank", Title: "Bad Request", Status: http.StatusBadRequest, Detail: "name is required; category is required", Instance: "/items", Code: codeValidation, Errors: []FieldError{{Field: "name", Message: "is required"}, {Field: "category", Message: "is required"}}},
+		},
+		"not found": {
+			err:  fmt.Errorf("failed to get item: %w", errItemNotFound),
+			want: Problem{Type: "about:blank", Title: "Not Found", Status: http.StatusNotFound, Detail: "failed to get item: item not found", Instance: "/items", Code: codeNotFound},
+		},
+		"too large": {
+			err:  validationError(&tooLargeError{Target: "image", Limit: 100}),
+			want: Problem{Type: "about:blank", Title: "Request Entity Too Large", Status: http.StatusRequestEntityTooLarge, Detail: "image is larger than 100 bytes", Instance: "/items", Code: codePayloadTooLarge, Target: "image", LimitBytes: 100},
+		},
+		"unsupported image": {
+			err:  errUnsupportedImage,
+			want: Problem{Type: "about:blank", Title: "Unsupported Media Type", Status: http.StatusUnsupportedMediaType, Detail: errUnsupportedImage.Error(), Instance: "/items", Code: codeUnsupportedMedia},
+		},
+		"conflict": {
+			err:  fmt.Errorf("failed to insert image upload: %w", errConflict),
+			want: Problem{Type: "about:blank", Title: "Conflict", Status: http.StatusConflict, Detail: "failed to insert image upload: conflicts with the stored data", Instance: "/items", Code: codeConflict},
+		},
+		"internal error isn't a validation error": {
+			err:  validationError(internalError(errors.New("open /tmp/upload-1: no space left on device"))),
+			want: Problem{Type: "about:blank", Title: "Internal Server Error", Status: http.StatusInternalServerError, Detail: "an internal error occurred", Instance: "/items", Code: codeInternal},
+		},
+		"internal error hides the message": {
+			err:  errors.New("no such table: items"),
+			want: Problem{Type: "about:blank", Title: "Internal Server Error", Status: http.StatusInternalServerError, Detail: "an internal error occurred", Instance: "/items", Code: codeInternal},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest("POST", "/items", nil)
+			rr := httptest.NewRecorder()
+			writeError(rr, req, tt.err)
+
+			if rr.Code != tt.want.Status {
+				t.Errorf("expected status code %d, got %d", tt.want.Status, rr.Code)
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("expected Content-Type application/problem+json, got %s", ct)
+			}
+			var got Problem
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected response (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// This file defines the endpoints checked by docker compose and orchestrators such as Kubernetes.
+// GET /healthz tells whether the process is alive, and GET /readyz tells whether it can serve requests,
+// i.e. the database and the image store are available. GET /version returns the build of the server.
+
+// readyTimeout is the time the dependencies checked by GET /readyz must respond in.
+const readyTimeout = 2 * time.Second
+
+// errNoBuildInfo is returned by GET /version when the binary was built without module support.
+var errNoBuildInfo = errors.New("build information is not available")
+
+// Statuses of the health and readiness checks.
+const (
+	healthOK          = "ok"
+	healthUnavailable = "unavailable"
+)
+
+// HealthV1 is the result of GET /healthz and GET /readyz in version 1 of the API.
+type HealthV1 struct {
+	Status string `json:"status"`
+	// Checks are the statuses of the dependencies checked by GET /readyz, such as "database".
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// VersionV1 is the build information returned by GET /version in version 1 of the API.
+// The VCS fields are set only if the binary was built by `go build` in a repository.
+type VersionV1 struct {
+	Path      string `json:"path"`
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+// Healthz is a handler to return that the server is alive for GET /healthz .
+// It doesn't check the dependencies, so that the server isn't restarted when the database is temporarily unavailable.
+func (s *Handlers) Healthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, r, http.StatusOK, HealthV1{Status: healthOK})
+}
+
+// Readyz is a handler to check that the server can serve requests for GET /readyz .
+// It returns 503 Service Unavailable if the database or the image store isn't available.
+func (s *Handlers) Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	checks := []struct {
+		name  string
+		check func(context.Context) error
+	}{
+		{"database", s.itemRepo.Ping},
+		{"images", s.images.Check},
+	}
+
+	resp := HealthV1{Status: healthOK, Checks: map[string]string{}}
+	code := http.StatusOK
+	for _, c := range checks {
+		if err := c.check(ctx); err != nil {
+			// the errors aren't returned, since they may contain internal information such as paths
+			slog.ErrorContext(r.Context(), "readiness check failed: ", "check", c.name, "error", err)
+			resp.Checks[c.name] = healthUnavailable
+			resp.Status = healthUnavailable
+			code = http.StatusServiceUnavailable
+			continue
+		}
+		resp.Checks[c.name] = healthOK
+	}
+	writeHealth(w, r, code, resp)
+}
+
+// Version is a handler to return the build information of the server for GET /version .
+func (s *Handlers) Version(w http.ResponseWriter, r *http.Request) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		writeError(w, r, errNoBuildInfo)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(newVersionV1(info)); err != nil {
+		writeError(w, r, err)
+		return
+	}
+}
+
+// writeHealth writes the result of a health check. It's never cached, so that probes see the current status.
+func writeHealth(w http.ResponseWriter, r *http.Request, code int, resp HealthV1) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.ErrorContext(r.Context(), "failed to write response: ", "error", err, "path", r.URL.Path)
+	}
+}
+
+func newVersionV1(info *debug.BuildInfo) VersionV1 {
+	v := VersionV1{
+		Path:      info.Main.Path,
+		Version:   info.Main.Version,
+		GoVersion: info.GoVersion,
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			v.Revision = s.Value
+		case "vcs.time":
+			v.Time = s.Value
+		case "vcs.modified":
+			v.Modified = s.Value == "true"
+		}
+	}
+	return v
+}
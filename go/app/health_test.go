@@ -0,0 +1,130 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime/debug"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/mock/gomock"
+)
+
+func TestHealthz(t *testing.T) {
+	t.Parallel()
+
+	h := &Handlers{}
+	rr := httptest.NewRecorder()
+	h.Healthz(rr, httptest.NewRequest("GET", "/healthz", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+	var got HealthV1
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if diff := cmp.Diff(HealthV1{Status: healthOK}, got); diff != "" {
+		t.Errorf("unexpected response (-want +got):\n%s", diff)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	t.Parallel()
+
+	type wants struct {
+		code int
+		resp HealthV1
+	}
+	cases := map[string]struct {
+		pingErr      error
+		removeImgDir bool
+		wants
+	}{
+		"ok: all the dependencies are available": {
+			wants: wants{
+				code: http.StatusOK,
+				resp: HealthV1{Status: healthOK, Checks: map[string]string{"database": healthOK, "images": healthOK}},
+			},
+		},
+		"ng: the database is unavailable": {
+			pingErr: errors.New("database is locked"),
+			wants: wants{
+				code: http.StatusServiceUnavailable,
+				resp: HealthV1{Status: healthUnavailable, Checks: map[string]string{"database": healthUnavailable, "images": healthOK}},
+			},
+		},
+		"ng: the image directory isn't writable": {
+			removeImgDir: true,
+			wants: wants{
+				code: http.StatusServiceUnavailable,
+				resp: HealthV1{Status: healthUnavailable, Checks: map[string]string{"database": healthOK, "images": healthUnavailable}},
+			},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			store, err := NewLocalImageStore(dir)
+			if err != nil {
+				t.Fatalf("failed to create image store: %v", err)
+			}
+			if tt.removeImgDir {
+				if err := os.RemoveAll(dir); err != nil {
+					t.Fatalf("failed to remove image directory: %v", err)
+				}
+			}
+
+			ctrl := gomock.NewController(t)
+			mockIR := NewMockItemRepository(ctrl)
+			mockIR.EXPECT().Ping(gomock.Any()).Return(tt.pingErr)
+			h := &Handlers{images: store, itemRepo: mockIR}
+
+			rr := httptest.NewRecorder()
+			h.Readyz(rr, httptest.NewRequest("GET", "/readyz", nil))
+
+			if rr.Code != tt.wants.code {
+				t.Errorf("expected status code %d, got %d", tt.wants.code, rr.Code)
+			}
+			var got HealthV1
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if diff := cmp.Diff(tt.wants.resp, got); diff != "" {
+				t.Errorf("unexpected response (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewVersionV1(t *testing.T) {
+	t.Parallel()
+
+	info := &debug.BuildInfo{
+		GoVersion: "go1.24.0",
+		Main:      debug.Module{Path: "mercari-build-training", Version: "(devel)"},
+		Settings: []debug.BuildSetting{
+			{Key: "-compiler", Value: "gc"},
+			{Key: "vcs.revision", Value: "4fc04f8"},
+			{Key: "vcs.time", Value: "2025-04-01T00:00:00Z"},
+			{Key: "vcs.modified", Value: "true"},
+		},
+	}
+	want := VersionV1{
+		Path:      "mercari-build-training",
+		Version:   "(devel)",
+		GoVersion: "go1.24.0",
+		Revision:  "4fc04f8",
+		Time:      "2025-04-01T00:00:00Z",
+		Modified:  true,
+	}
+	if diff := cmp.Diff(want, newVersionV1(info)); diff != "" {
+		t.Errorf("unexpected version (-want +got):\n%s", diff)
+	}
+}
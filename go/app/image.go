@@ -0,0 +1,276 @@
+package app
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	// register the decoders used by image.Decode and image.DecodeConfig
+	_ "image/gif"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// This file validates uploaded images. The format of an image is detected from its content,
+// since the file name and the Content-Type sent by clients can't be trusted.
+
+var (
+	errUnsupportedImage = errors.New("unsupported image")
+	errImageTooLarge    = errors.New("image too large")
+)
+
+// maxImagePixels is the maximum number of pixels in an uploaded image, which is larger than photos taken by phones.
+// A small file can decode into a huge image (a decompression bomb), so images are checked before they're decoded.
+// A JPEG image takes up to 3 bytes per pixel to decode and 3 more to rotate (see sanitizeJPEG),
+// which is about 100 MB at this size. The frames of an animated GIF image are counted together.
+const maxImagePixels = 16_000_000
+
+// imageFormat is an image format accepted by the server.
+type imageFormat struct {
+	// ContentType is the media type detected by http.DetectContentType.
+	ContentType string
+	// Exts are the extensions of the stored files. The first one is used for new files.
+	Exts []string
+}
+
+// imageFormats are the image formats the server can handle.
+var imageFormats = []imageFormat{
+	{ContentType: "image/jpeg", Exts: []string{".jpg", ".jpeg"}},
+	{ContentType: "image/png", Exts: []string{".png"}},
+	{ContentType: "image/gif", Exts: []string{".gif"}},
+	{ContentType: "image/webp", Exts: []string{".webp"}},
+}
+
+// DefaultImageTypes are the media types of the images accepted when Server.ImageTypes is empty.
+var DefaultImageTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// imageFormatByContentType returns the image format of a media type, or nil if the format isn't supported.
+func imageFormatByContentType(contentType string) *imageFormat {
+	for i := range imageFormats {
+		if imageFormats[i].ContentType == contentType {
+			return &imageFormats[i]
+		}
+	}
+	return nil
+}
+
+// imageFormatByName returns the image format of a file name, or nil if the format isn't supported.
+func imageFormatByName(name string) *imageFormat {
+	ext := strings.ToLower(path.Ext(name))
+	for i := range imageFormats {
+		for _, e := range imageFormats[i].Exts {
+			if e == ext {
+				return &imageFormats[i]
+			}
+		}
+	}
+	return nil
+}
+
+// detectImageFormat detects the format of an image from its content and checks its size.
+// It returns errUnsupportedImage if the image isn't one of the allowed media types or is broken,
+// and errImageTooLarge if the image has too many pixels.
+func detectImageFormat(data []byte, allowedTypes []string) (*imageFormat, error) {
+	contentType := http.DetectContentType(data)
+	format := imageFormatByContentType(contentType)
+	if format == nil {
+		return nil, fmt.Errorf("%w: %s", errUnsupportedImage, contentType)
+	}
+	if len(allowedTypes) == 0 {
+		allowedTypes = DefaultImageTypes
+	}
+	allowed := false
+	for _, t := range allowedTypes {
+		if t == contentType {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return nil, fmt.Errorf("%w: %s isn't allowed", errUnsupportedImage, contentType)
+	}
+
+	// DecodeConfig only reads the header, so it's safe to use before checking the size
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errUnsupportedImage, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, fmt.Errorf("%w: empty image", errUnsupportedImage)
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxImagePixels {
+		return nil, fmt.Errorf("%w: %dx%d pixels", errImageTooLarge, cfg.Width, cfg.Height)
+	}
+	// DecodeConfig only reads the logical screen size of a GIF image, which can have any number of frames of that size
+	if format.ContentType == "image/gif" {
+		pixels, err := gifPixels(data)
+		if err != nil {
+			return nil, err
+		}
+		if pixels > maxImagePixels {
+			return nil, fmt.Errorf("%w: %d pixels in the frames", errImageTooLarge, pixels)
+		}
+	}
+	return format, nil
+}
+
+// gifBlock is a block of a GIF image following the header and the global color table.
+type gifBlock struct {
+	// Introducer is 0x21 for an extension, 0x2c for an image and 0x3b for the trailer.
+	Introducer byte
+	// Label is the label of an extension, e.g. 0xfe for a comment.
+	Label byte
+	// Width and Height are the size of an image.
+	Width, Height int
+	// Data is the whole block.
+	Data []byte
+}
+
+// forEachGIFBlock calls fn with each block of a GIF image up to the trailer, without decoding the images.
+// It returns the length of the header and the global color table preceding the blocks,
+// or errBrokenImage if the blocks can't be read.
+func forEachGIFBlock(data []byte, fn func(b gifBlock)) (int, error) {
+	const screenLen = 13 // the header and the logical screen descriptor
+	if len(data) < screenLen {
+		return 0, errBrokenImage
+	}
+	headerLen := screenLen + gifColorTableLen(data[10])
+	for i := headerLen; i < len(data); {
+		b := gifBlock{Introducer: data[i]}
+		start := i
+		switch b.Introducer {
+		case 0x3b:
+			b.Data = data[i : i+1]
+			fn(b)
+			return headerLen, nil
+		case 0x21:
+			if i+2 > len(data) {
+				return 0, errBrokenImage
+			}
+			b.Label = data[i+1]
+			i += 2
+		case 0x2c:
+			if i+10 > len(data) {
+				return 0, errBrokenImage
+			}
+			b.Width = int(binary.LittleEndian.Uint16(data[i+5:]))
+			b.Height = int(binary.LittleEndian.Uint16(data[i+7:]))
+			// the image descriptor, the local color table and the minimum code size of LZW
+			i += 10 + gifColorTableLen(data[i+9]) + 1
+		default:
+			return 0, errBrokenImage
+		}
+		// the data sub-blocks end with an empty one
+		for {
+			if i >= len(data) {
+				return 0, errBrokenImage
+			}
+			size := int(data[i])
+			i += 1 + size
+			if size == 0 {
+				break
+			}
+		}
+		if i > len(data) {
+			return 0, errBrokenImage
+		}
+		b.Data = data[start:i]
+		fn(b)
+	}
+	// the trailer is missing
+	return 0, errBrokenImage
+}
+
+// gifColorTableLen returns the length of the color table following a descriptor with the packed fields.
+func gifColorTableLen(packed byte) int {
+	if packed&0x80 == 0 {
+		return 0
+	}
+	return 3 << (packed&0x07 + 1)
+}
+
+// gifPixels returns the total number of pixels in the frames of a GIF image.
+func gifPixels(data []byte) (int64, error) {
+	var pixels int64
+	_, err := forEachGIFBlock(data, func(b gifBlock) {
+		pixels += int64(b.Width) * int64(b.Height)
+	})
+	return pixels, err
+}
+
+// imageVariantWidths are the widths of the resized variants of images the server generates.
+// Only these widths are accepted, so that clients can't fill the storage with arbitrary sizes.
+var imageVariantWidths = []int{200, 400, 800}
+
+// thumbnailWidth is the width of the variant returned by GET /images/{filename}/thumb .
+const thumbnailWidth = 200
+
+// isImageVariantWidth reports whether width is one of imageVariantWidths.
+func isImageVariantWidth(width int) bool {
+	for _, w := range imageVariantWidths {
+		if w == width {
+			return true
+		}
+	}
+	return false
+}
+
+// imageVariantName returns the file name of the variant of an image resized to width,
+// e.g. "<sha256>.w200.jpg" for "<sha256>.jpg". Variants of JPEG images are JPEG, and the others are PNG
+// since there's no pure-Go encoder for WebP and PNG keeps transparency.
+func imageVariantName(name string, width int) string {
+	ext := path.Ext(name)
+	variantExt := ".png"
+	if format := imageFormatByName(name); format != nil && format.ContentType == "image/jpeg" {
+		variantExt = ".jpg"
+	}
+	return strings.TrimSuffix(name, ext) + ".w" + strconv.Itoa(width) + variantExt
+}
+
+// resizeImage decodes an image and encodes it again with the given width keeping its aspect ratio,
+// in the format of the extension of variantName. Images narrower than width aren't enlarged.
+func resizeImage(r io.Reader, width int, variantName string) ([]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	// the image may have been stored before the size was checked on upload
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxImagePixels {
+		return nil, fmt.Errorf("%w: %dx%d pixels", errImageTooLarge, cfg.Width, cfg.Height)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	width = min(width, bounds.Dx())
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	var b bytes.Buffer
+	if path.Ext(variantName) == ".jpg" {
+		err = jpeg.Encode(&b, dst, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&b, dst)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,103 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// This file removes the images no longer referenced by any item.
+// storeImage dedups images by their hash, so an image can be shared by items and can't be removed
+// when an item is updated or deleted. Instead, the unreferenced images are collected periodically.
+// The images uploaded with POST /images are kept until their uploads expire.
+
+// DefaultImageGCGrace is the default of ImageGCOptions.Grace.
+const DefaultImageGCGrace = 24 * time.Hour
+
+// ImageGCOptions are the options of CollectImages.
+type ImageGCOptions struct {
+	// Grace is the time an image is kept after it was stored, even if no item references it.
+	// It protects the images uploaded while the items referencing them are being saved.
+	Grace time.Duration
+	// DryRun only reports the images to remove without removing them.
+	DryRun bool
+}
+
+// ImageGCResult is the result of CollectImages.
+type ImageGCResult struct {
+	// Removed are the images removed, or the ones which would be removed on a dry run.
+	Removed []ImageInfo
+	// Kept is the number of images kept.
+	Kept int
+	// ExpiredUploads is the number of the expired image uploads deleted. It's 0 on a dry run.
+	ExpiredUploads int64
+}
+
+// CollectImages removes the images in the store which aren't referenced by any item or unexpired upload
+// in the repository, and deletes the expired uploads.
+// Resized variants are removed with their originals. The default image is never removed.
+func CollectImages(ctx context.Context, repo ItemRepository, images ImageStore, opts ImageGCOptions) (*ImageGCResult, error) {
+	// list the images first, so that images stored after reading the references are within the grace period
+	infos, err := images.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := &ImageGCResult{}
+	if !opts.DryRun {
+		if result.ExpiredUploads, err = repo.DeleteExpiredImageUploads(ctx, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	names, err := repo.GetImageNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	referenced := make(map[string]bool, len(names)+1)
+	for _, name := range names {
+		referenced[imageKey(name)] = true
+	}
+	referenced[imageKey(defaultImageName)] = true
+
+	deadline := time.Now().Add(-opts.Grace)
+	for _, info := range infos {
+		if referenced[imageKey(info.Name)] || info.ModTime.After(deadline) {
+			result.Kept++
+			continue
+		}
+		if !opts.DryRun {
+			if err := images.Delete(ctx, info.Name); err != nil {
+				return result, err
+			}
+		}
+		result.Removed = append(result.Removed, info)
+	}
+	return result, nil
+}
+
+// imageKey returns the part of an image name shared by the image and its variants,
+// which is the hash of the image, e.g. "<sha256>" for "<sha256>.jpg" and "<sha256>.w200.jpg".
+func imageKey(name string) string {
+	key, _, _ := strings.Cut(name, ".")
+	return key
+}
+
+// runImageGC runs CollectImages every interval until ctx is canceled.
+func runImageGC(ctx context.Context, repo ItemRepository, images ImageStore, interval time.Duration, opts ImageGCOptions) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		result, err := CollectImages(ctx, repo, images, opts)
+		if err != nil {
+			slog.Error("failed to collect images: ", "error", err)
+			continue
+		}
+		slog.Info("collected images", "removed", len(result.Removed), "kept", result.Kept, "expired_uploads", result.ExpiredUploads)
+	}
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/mock/gomock"
+)
+
+func TestCollectImages(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		dryRun      bool
+		wantRemoved []string
+		wantLeft    []string
+	}{
+		"ok: unreferenced images are removed": {
+			wantRemoved: []string{"old.jpg", "old.w200.jpg"},
+			wantLeft:    []string{"default.jpg", "default.w200.jpg", "new.jpg", "used.png", "used.w200.png"},
+		},
+		"ok: dry run": {
+			dryRun:      true,
+			wantRemoved: []string{"old.jpg", "old.w200.jpg"},
+			wantLeft:    []string{"default.jpg", "default.w200.jpg", "new.jpg", "old.jpg", "old.w200.jpg", "used.png", "used.w200.png"},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			store, err := NewLocalImageStore(dir)
+			if err != nil {
+				t.Fatalf("failed to create image store: %v", err)
+			}
+			old := time.Now().Add(-48 * time.Hour)
+			for _, name := range []string{"default.jpg", "default.w200.jpg", "new.jpg", "old.jpg", "old.w200.jpg", "used.png", "used.w200.png"} {
+				if err := store.Put(t.Context(), name, strings.NewReader(name), int64(len(name))); err != nil {
+					t.Fatalf("failed to put image: %v", err)
+				}
+				// new.jpg was just uploaded, and the others were stored before the grace period
+				if name != "new.jpg" {
+					if err := os.Chtimes(filepath.Join(dir, name), old, old); err != nil {
+						t.Fatalf("failed to change modification time: %v", err)
+					}
+				}
+			}
+
+			ctrl := gomock.NewController(t)
+			mockIR := NewMockItemRepository(ctrl)
+			if !tt.dryRun {
+				mockIR.EXPECT().DeleteExpiredImageUploads(gomock.Any(), gomock.Any()).Return(int64(1), nil)
+			}
+			mockIR.EXPECT().GetImageNames(gomock.Any()).Return([]string{"used.png"}, nil)
+
+			result, err := CollectImages(t.Context(), mockIR, store, ImageGCOptions{Grace: DefaultImageGCGrace, DryRun: tt.dryRun})
+			if err != nil {
+				t.Fatalf("failed to collect images: %v", err)
+			}
+			removed := []string{}
+			for _, info := range result.Removed {
+				removed = append(removed, info.Name)
+			}
+			if diff := cmp.Diff(tt.wantRemoved, removed); diff != "" {
+				t.Errorf("unexpected removed images (-want +got):\n%s", diff)
+			}
+
+			infos, err := store.List(t.Context())
+			if err != nil {
+				t.Fatalf("failed to list images: %v", err)
+			}
+			left := []string{}
+			for _, info := range infos {
+				left = append(left, info.Name)
+			}
+			if diff := cmp.Diff(tt.wantLeft, left); diff != "" {
+				t.Errorf("unexpected images left (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,333 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+)
+
+// This file removes metadata such as EXIF from uploaded images before they're stored,
+// since photos taken by phones have the location where they were taken.
+// JPEG images are decoded and encoded again, and the other formats have their metadata chunks or blocks removed,
+// which keeps their pixels as they are without decoding them.
+
+// errBrokenImage is returned for images which can't be parsed, and is an errUnsupportedImage.
+var errBrokenImage = fmt.Errorf("%w: broken image", errUnsupportedImage)
+
+// jpegQuality is the quality of the JPEG images encoded again.
+const jpegQuality = 90
+
+// maxConcurrentDecodes is the maximum number of images decoded and encoded again at the same time.
+// Decoding takes memory in proportion to the pixels (see maxImagePixels), so the uploads beyond it wait for the others.
+const maxConcurrentDecodes = 4
+
+// decodeSlots has a value for each image being decoded.
+var decodeSlots = make(chan struct{}, maxConcurrentDecodes)
+
+// sanitizeImage returns an image with the same pixels as data without metadata.
+// For JPEG images, the EXIF orientation is applied to the pixels, since it's removed with the metadata.
+// It waits while maxConcurrentDecodes images are being decoded, and returns the error of ctx if it's canceled.
+func sanitizeImage(ctx context.Context, data []byte, format *imageFormat) ([]byte, error) {
+	if format.ContentType == "image/jpeg" {
+		select {
+		case decodeSlots <- struct{}{}:
+			defer func() { <-decodeSlots }()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	switch format.ContentType {
+	case "image/jpeg":
+		return sanitizeJPEG(data)
+	case "image/png":
+		return sanitizePNG(data)
+	case "image/gif":
+		return sanitizeGIF(data)
+	case "image/webp":
+		return sanitizeWebP(data)
+	default:
+		return nil, errUnsupportedImage
+	}
+}
+
+// jpegSOI is the marker at the start of a JPEG image.
+var jpegSOI = []byte{0xff, 0xd8}
+
+// jpegICCPrefix is the prefix of the APP2 segments with the ICC color profile of a JPEG image.
+var jpegICCPrefix = []byte("ICC_PROFILE\x00")
+
+func sanitizeJPEG(data []byte) ([]byte, error) {
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Join(errBrokenImage, err)
+	}
+	img = applyOrientation(img, jpegOrientation(data))
+
+	// the color profile is kept, since the colors of wide-gamut photos (e.g. Display P3) shift without it.
+	// CMYK images are encoded in RGB, which the profile of the original image doesn't apply to.
+	var iccSegments [][]byte
+	if _, ok := img.(*image.CMYK); !ok {
+		forEachJPEGSegment(data, func(marker byte, segment []byte) {
+			if marker == 0xe2 && bytes.HasPrefix(segment[4:], jpegICCPrefix) {
+				iccSegments = append(iccSegments, segment)
+			}
+		})
+	}
+
+	// the encoder doesn't write any metadata, so the profile is inserted after SOI
+	var b bytes.Buffer
+	b.Write(jpegSOI)
+	for _, segment := range iccSegments {
+		b.Write(segment)
+	}
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, err
+	}
+	b.Write(bytes.TrimPrefix(encoded.Bytes(), jpegSOI))
+	return b.Bytes(), nil
+}
+
+// forEachJPEGSegment calls fn with the marker and the whole segment (from 0xff to the end of the data)
+// of each segment of a JPEG image before the image data.
+func forEachJPEGSegment(data []byte, fn func(marker byte, segment []byte)) {
+	// skip SOI and read the segments before the image data
+	for i := 2; i+4 <= len(data) && data[i] == 0xff; {
+		marker := data[i+1]
+		if marker == 0xda { // SOS
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			break
+		}
+		fn(marker, data[i:i+2+length])
+		i += 2 + length
+	}
+}
+
+// jpegOrientation returns the orientation in the EXIF of a JPEG image (1 to 8), or 1 if it's not found.
+func jpegOrientation(data []byte) int {
+	orientation := 1
+	forEachJPEGSegment(data, func(marker byte, segment []byte) {
+		if marker == 0xe1 && bytes.HasPrefix(segment[4:], []byte("Exif\x00\x00")) {
+			orientation = exifOrientation(segment[10:])
+		}
+	})
+	return orientation
+}
+
+// exifOrientation returns the Orientation tag in IFD0 of EXIF data (a TIFF header and IFDs), or 1 if it's not found.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := range entries {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		// the Orientation tag is a SHORT value stored in the entry
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+		}
+	}
+	return 1
+}
+
+// applyOrientation rotates and flips an image so that it's displayed as the EXIF orientation specifies.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	// src maps a pixel in the result to the pixel in img
+	var src func(x, y int) (int, int)
+	dw, dh := w, h
+	switch orientation {
+	case 2: // flipped horizontally
+		src = func(x, y int) (int, int) { return w - 1 - x, y }
+	case 3: // rotated 180°
+		src = func(x, y int) (int, int) { return w - 1 - x, h - 1 - y }
+	case 4: // flipped vertically
+		src = func(x, y int) (int, int) { return x, h - 1 - y }
+	case 5: // transposed
+		dw, dh = h, w
+		src = func(x, y int) (int, int) { return y, x }
+	case 6: // needs to be rotated 90° clockwise
+		dw, dh = h, w
+		src = func(x, y int) (int, int) { return y, h - 1 - x }
+	case 7: // transversed
+		dw, dh = h, w
+		src = func(x, y int) (int, int) { return w - 1 - y, h - 1 - x }
+	case 8: // needs to be rotated 90° counterclockwise
+		dw, dh = h, w
+		src = func(x, y int) (int, int) { return w - 1 - y, x }
+	}
+
+	// the pixels are copied from the decoded image as they are, without converting their colors
+	r := image.Rect(0, 0, dw, dh)
+	each := func(copyPixel func(x, y, sx, sy int)) {
+		for y := range dh {
+			for x := range dw {
+				sx, sy := src(x, y)
+				copyPixel(x, y, b.Min.X+sx, b.Min.Y+sy)
+			}
+		}
+	}
+	switch s := img.(type) {
+	case *image.YCbCr:
+		// each pixel has its own chroma, since the subsampled chroma can't be rotated with the pixels
+		dst := image.NewYCbCr(r, image.YCbCrSubsampleRatio444)
+		each(func(x, y, sx, sy int) {
+			dst.Y[dst.YOffset(x, y)] = s.Y[s.YOffset(sx, sy)]
+			i, j := dst.COffset(x, y), s.COffset(sx, sy)
+			dst.Cb[i], dst.Cr[i] = s.Cb[j], s.Cr[j]
+		})
+		return dst
+	case *image.Gray:
+		dst := image.NewGray(r)
+		each(func(x, y, sx, sy int) {
+			dst.Pix[dst.PixOffset(x, y)] = s.Pix[s.PixOffset(sx, sy)]
+		})
+		return dst
+	case *image.CMYK:
+		dst := image.NewCMYK(r)
+		each(func(x, y, sx, sy int) {
+			i, j := dst.PixOffset(x, y), s.PixOffset(sx, sy)
+			copy(dst.Pix[i:i+4], s.Pix[j:j+4])
+		})
+		return dst
+	default:
+		dst := image.NewRGBA(r)
+		each(func(x, y, sx, sy int) {
+			dst.Set(x, y, img.At(sx, sy))
+		})
+		return dst
+	}
+}
+
+// pngKeptChunks are the PNG chunks needed to display images. The other chunks such as tEXt and eXIf are removed.
+var pngKeptChunks = map[string]bool{
+	"IHDR": true, "PLTE": true, "IDAT": true, "IEND": true,
+	"tRNS": true, "gAMA": true, "cHRM": true, "sRGB": true, "iCCP": true, "sBIT": true, "bKGD": true, "pHYs": true,
+	// animated PNG
+	"acTL": true, "fcTL": true, "fdAT": true,
+}
+
+func sanitizePNG(data []byte) ([]byte, error) {
+	const signatureLen = 8
+	if len(data) < signatureLen {
+		return nil, errBrokenImage
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:signatureLen])
+	for i := signatureLen; i < len(data); {
+		// length, type, data and CRC
+		if i+8 > len(data) {
+			return nil, errBrokenImage
+		}
+		end := i + 12 + int(binary.BigEndian.Uint32(data[i:]))
+		if end > len(data) || end < i {
+			return nil, errBrokenImage
+		}
+		if pngKeptChunks[string(data[i+4:i+8])] {
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+	return out.Bytes(), nil
+}
+
+// gifKeptApplications are the identifiers and authentication codes of the application extensions
+// needed to display GIF images: the loop count and the ICC color profile. The others such as XMP are removed.
+var gifKeptApplications = map[string]bool{
+	"NETSCAPE2.0": true, "ANIMEXTS1.0": true, "ICCRGBG1012": true,
+}
+
+func sanitizeGIF(data []byte) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	headerLen, err := forEachGIFBlock(data, func(b gifBlock) {
+		if b.Introducer == 0x21 {
+			switch {
+			case b.Label == 0xfe: // comment
+				return
+			case b.Label == 0xff && (len(b.Data) < 14 || !gifKeptApplications[string(b.Data[3:14])]):
+				return
+			}
+		}
+		out.Write(b.Data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 0, headerLen+out.Len())
+	b = append(b, data[:headerLen]...)
+	return append(b, out.Bytes()...), nil
+}
+
+// webpMetadataFlags are the bits of the VP8X flags telling that the image has EXIF and XMP chunks.
+const webpMetadataFlags = 0x08 | 0x04
+
+func sanitizeWebP(data []byte) ([]byte, error) {
+	const headerLen = 12 // "RIFF", the file size and "WEBP"
+	if len(data) < headerLen {
+		return nil, errBrokenImage
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:headerLen])
+	for i := headerLen; i < len(data); {
+		// FourCC, size and data padded to an even size
+		if i+8 > len(data) {
+			return nil, errBrokenImage
+		}
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size + size%2
+		if end > len(data) || end < i {
+			return nil, errBrokenImage
+		}
+		switch string(data[i : i+4]) {
+		case "EXIF", "XMP ":
+			// removed
+		case "VP8X":
+			chunk := bytes.Clone(data[i:end])
+			if len(chunk) > 8 {
+				chunk[8] &^= webpMetadataFlags
+			}
+			out.Write(chunk)
+		default:
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+
+	b := out.Bytes()
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(b)-8))
+	return b, nil
+}
@@ -0,0 +1,202 @@
+package app
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"slices"
+	"testing"
+)
+
+func TestSanitizeJPEG(t *testing.T) {
+	t.Parallel()
+
+	// a 4x2 image whose left half is white, taken with the camera rotated (orientation 6)
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for y := range 2 {
+		for x := range 2 {
+			src.Set(x, y, color.White)
+		}
+	}
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, src, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatalf("failed to encode image: %v", err)
+	}
+	// EXIF with Orientation = 6 and a fake GPS tag value
+	tiff := []byte("II*\x00\x08\x00\x00\x00" + "\x01\x00" + "\x12\x01\x03\x00\x01\x00\x00\x00\x06\x00\x00\x00" + "GPS 35.6812N 139.7671E")
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	segment := binary.BigEndian.AppendUint16([]byte{0xff, 0xe1}, uint16(len(app1)+2))
+	// the first and only chunk of a (fake) color profile
+	app2 := append([]byte("ICC_PROFILE\x00\x01\x01"), "Display P3"...)
+	icc := append(binary.BigEndian.AppendUint16([]byte{0xff, 0xe2}, uint16(len(app2)+2)), app2...)
+	data := append(append(append(append([]byte{}, b.Bytes()[:2]...), append(segment, app1...)...), icc...), b.Bytes()[2:]...)
+
+	if got := jpegOrientation(data); got != 6 {
+		t.Fatalf("expected orientation 6, got %d", got)
+	}
+	got, err := sanitizeImage(t.Context(), data, imageFormatByContentType("image/jpeg"))
+	if err != nil {
+		t.Fatalf("failed to sanitize image: %v", err)
+	}
+	if bytes.Contains(got, []byte("Exif")) || bytes.Contains(got, []byte("GPS")) {
+		t.Errorf("EXIF is not removed")
+	}
+	// the color profile is kept after SOI
+	if !bytes.HasPrefix(got, append([]byte{0xff, 0xd8}, icc...)) {
+		t.Errorf("the color profile is not kept")
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(got))
+	if err != nil {
+		t.Fatalf("failed to decode sanitized image: %v", err)
+	}
+	if img.Bounds().Dx() != 2 || img.Bounds().Dy() != 4 {
+		t.Fatalf("expected 2x4 image, got %v", img.Bounds())
+	}
+	// rotated clockwise, the white half is on the top
+	if r, _, _, _ := img.At(0, 0).RGBA(); r < 0xf000 {
+		t.Errorf("expected the top to be white, got %v", img.At(0, 0))
+	}
+	if r, _, _, _ := img.At(0, 3).RGBA(); r > 0x1000 {
+		t.Errorf("expected the bottom to be black, got %v", img.At(0, 3))
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	t.Parallel()
+
+	// a 3x2 image with a different value in each pixel
+	gray := image.NewGray(image.Rect(0, 0, 3, 2))
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i * 40)
+	}
+	ycbcr := image.NewYCbCr(gray.Bounds(), image.YCbCrSubsampleRatio444)
+	copy(ycbcr.Y, gray.Pix)
+	for i := range ycbcr.Cb {
+		ycbcr.Cb[i], ycbcr.Cr[i] = 128, 128
+	}
+	nrgba := image.NewNRGBA(gray.Bounds())
+	draw.Draw(nrgba, nrgba.Bounds(), gray, image.Point{}, draw.Src)
+	// rows of the 6 pixels displayed for each orientation
+	want := map[int][][]uint8{
+		1: {{0, 40, 80}, {120, 160, 200}},
+		2: {{80, 40, 0}, {200, 160, 120}},
+		3: {{200, 160, 120}, {80, 40, 0}},
+		4: {{120, 160, 200}, {0, 40, 80}},
+		5: {{0, 120}, {40, 160}, {80, 200}},
+		6: {{120, 0}, {160, 40}, {200, 80}},
+		7: {{200, 80}, {160, 40}, {120, 0}},
+		8: {{80, 200}, {40, 160}, {0, 120}},
+	}
+
+	for orientation, rows := range want {
+		// the images decoded from JPEG are rotated without conversion, and the others through RGBA
+		for _, img := range []image.Image{gray, ycbcr, nrgba} {
+			got := applyOrientation(img, orientation)
+			if got.Bounds().Dx() != len(rows[0]) || got.Bounds().Dy() != len(rows) {
+				t.Fatalf("orientation %d of %T: expected %dx%d image, got %v", orientation, img, len(rows[0]), len(rows), got.Bounds())
+			}
+			for y, row := range rows {
+				for x, v := range row {
+					if c := color.GrayModel.Convert(got.At(x, y)).(color.Gray); c.Y != v {
+						t.Errorf("orientation %d of %T: expected %d at (%d, %d), got %d", orientation, img, v, x, y, c.Y)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestSanitizePNG(t *testing.T) {
+	t.Parallel()
+
+	var b bytes.Buffer
+	if err := png.Encode(&b, image.NewRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatalf("failed to encode image: %v", err)
+	}
+	// insert a tEXt chunk after IHDR (the signature and a chunk of 13 bytes)
+	text := []byte("Comment\x00taken at home")
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(text)))
+	chunk = append(chunk, "tEXt"...)
+	chunk = append(chunk, text...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	data := append(append(append([]byte{}, b.Bytes()[:33]...), chunk...), b.Bytes()[33:]...)
+
+	got, err := sanitizeImage(t.Context(), data, imageFormatByContentType("image/png"))
+	if err != nil {
+		t.Fatalf("failed to sanitize image: %v", err)
+	}
+	if !bytes.Equal(got, b.Bytes()) {
+		t.Errorf("expected the original image without tEXt")
+	}
+}
+
+func TestSanitizeGIF(t *testing.T) {
+	t.Parallel()
+
+	var b bytes.Buffer
+	frame := image.NewPaletted(image.Rect(0, 0, 2, 2), color.Palette{color.Black, color.White})
+	if err := gif.EncodeAll(&b, &gif.GIF{Image: []*image.Paletted{frame, frame}, Delay: []int{10, 10}, LoopCount: 0}); err != nil {
+		t.Fatalf("failed to encode image: %v", err)
+	}
+	// the blocks after the header and the global color table, which start with the loop count
+	headerLen, err := forEachGIFBlock(b.Bytes(), func(gifBlock) {})
+	if err != nil {
+		t.Fatalf("failed to read image: %v", err)
+	}
+	header, blocks := b.Bytes()[:headerLen], b.Bytes()[headerLen:]
+	if !bytes.Contains(blocks, []byte("NETSCAPE2.0")) {
+		t.Fatal("expected the loop count in the image")
+	}
+
+	comment := []byte("\x21\xfe\x0dtaken at home\x00")
+	xmp := []byte("\x21\xff\x0bXMP DataXMP\x04<x/>\x00")
+	data := slices.Concat(header, comment, blocks[:len(blocks)-1], xmp, blocks[len(blocks)-1:])
+
+	got, err := sanitizeImage(t.Context(), data, imageFormatByContentType("image/gif"))
+	if err != nil {
+		t.Fatalf("failed to sanitize image: %v", err)
+	}
+	if !bytes.Equal(got, b.Bytes()) {
+		t.Errorf("expected the original image without the comment and XMP")
+	}
+}
+
+func TestSanitizeWebP(t *testing.T) {
+	t.Parallel()
+
+	chunk := func(fourCC string, data []byte) []byte {
+		c := binary.LittleEndian.AppendUint32([]byte(fourCC), uint32(len(data)))
+		c = append(c, data...)
+		if len(data)%2 == 1 {
+			c = append(c, 0)
+		}
+		return c
+	}
+	riff := func(chunks ...[]byte) []byte {
+		body := []byte("WEBP")
+		for _, c := range chunks {
+			body = append(body, c...)
+		}
+		return append(binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(len(body))), body...)
+	}
+	// the image data isn't decoded, so it doesn't need to be a valid bitstream
+	bitstream := chunk("VP8L", []byte{0x2f, 1, 2, 3, 4})
+
+	data := riff(chunk("VP8X", []byte{0x08 | 0x04 | 0x10, 0, 0, 0, 0, 0, 0, 0, 0, 0}), bitstream, chunk("EXIF", []byte("GPS")), chunk("XMP ", []byte("<x/>")))
+	want := riff(chunk("VP8X", []byte{0x10, 0, 0, 0, 0, 0, 0, 0, 0, 0}), bitstream)
+
+	got, err := sanitizeImage(t.Context(), data, imageFormatByContentType("image/webp"))
+	if err != nil {
+		t.Fatalf("failed to sanitize image: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,223 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// This file defines where the uploaded images are stored.
+// Handlers only use the ImageStore interface, so that images can be moved off the API container
+// by switching the backend in Server (see ImageBackend).
+
+var errInvalidImageName = errors.New("invalid image name")
+
+// ImageInfo describes an image in an ImageStore.
+type ImageInfo struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// ImageStore stores images by their file names.
+// Get and Stat return errImageNotFound if the image doesn't exist.
+type ImageStore interface {
+	// Put stores an image of size bytes read from r, replacing the image with the same name if any.
+	Put(ctx context.Context, name string, r io.Reader, size int64) error
+	// Get opens an image. The caller must close it.
+	Get(ctx context.Context, name string) (io.ReadSeekCloser, *ImageInfo, error)
+	Stat(ctx context.Context, name string) (*ImageInfo, error)
+	// Delete removes an image. Removing an image which doesn't exist isn't an error.
+	Delete(ctx context.Context, name string) error
+	// List returns all the images ordered by name.
+	List(ctx context.Context) ([]ImageInfo, error)
+	// Check checks that images can be stored, for the readiness check of the server.
+	Check(ctx context.Context) error
+}
+
+// Image backends selectable by Server.ImageBackend.
+const (
+	ImageBackendLocal = "local"
+	ImageBackendS3    = "s3"
+)
+
+// NewImageStore creates the ImageStore for the backend configured in the server.
+func NewImageStore(ctx context.Context, s Server) (ImageStore, error) {
+	switch s.ImageBackend {
+	case "", ImageBackendLocal:
+		return NewLocalImageStore(s.ImageDirPath)
+	case ImageBackendS3:
+		return NewS3ImageStore(ctx, s.S3)
+	default:
+		return nil, fmt.Errorf("unknown image backend: %s", s.ImageBackend)
+	}
+}
+
+// defaultImage is the image returned when an item has no image (see defaultImageName).
+// It's embedded so that it can be stored in any backend, such as a new bucket.
+//
+//go:embed assets/default.jpg
+var defaultImage []byte
+
+// seedDefaultImage stores the default image unless the store already has it.
+func seedDefaultImage(ctx context.Context, store ImageStore) error {
+	_, err := store.Stat(ctx, defaultImageName)
+	if !errors.Is(err, errImageNotFound) {
+		return err
+	}
+	return store.Put(ctx, defaultImageName, bytes.NewReader(defaultImage), int64(len(defaultImage)))
+}
+
+// validateImageName rejects names which aren't plain file names, to prevent directory traversal attacks.
+func validateImageName(name string) error {
+	if name == "" || name != filepath.Base(name) || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("%w: %q", errInvalidImageName, name)
+	}
+	return nil
+}
+
+type localImageStore struct {
+	// dir is the path to the directory storing images.
+	dir string
+}
+
+var _ ImageStore = (*localImageStore)(nil)
+
+// NewLocalImageStore creates an ImageStore which stores images in a directory of the local filesystem.
+func NewLocalImageStore(dir string) (ImageStore, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return &localImageStore{dir: dir}, nil
+}
+
+// Put stores an image in the directory.
+// The image is written to a temporary file first, so that readers never see a partially written image.
+func (s *localImageStore) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	if err := validateImageName(name); err != nil {
+		return err
+	}
+
+	// temporary files start with a dot, so that List skips them
+	f, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, io.LimitReader(r, size)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(s.dir, name))
+}
+
+// Get opens an image in the directory.
+func (s *localImageStore) Get(ctx context.Context, name string) (io.ReadSeekCloser, *ImageInfo, error) {
+	if err := validateImageName(name); err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.Open(filepath.Join(s.dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, errImageNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if fi.IsDir() {
+		f.Close()
+		return nil, nil, errImageNotFound
+	}
+	return f, newLocalImageInfo(fi), nil
+}
+
+// Stat returns the information of an image in the directory.
+func (s *localImageStore) Stat(ctx context.Context, name string) (*ImageInfo, error) {
+	if err := validateImageName(name); err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(filepath.Join(s.dir, name))
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && fi.IsDir()) {
+		return nil, errImageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newLocalImageInfo(fi), nil
+}
+
+// Delete removes an image from the directory.
+func (s *localImageStore) Delete(ctx context.Context, name string) error {
+	if err := validateImageName(name); err != nil {
+		return err
+	}
+
+	err := os.Remove(filepath.Join(s.dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// List returns the images in the directory.
+func (s *localImageStore) List(ctx context.Context) ([]ImageInfo, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]ImageInfo, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		fi, err := e.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			// removed after reading the directory
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, *newLocalImageInfo(fi))
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, nil
+}
+
+func newLocalImageInfo(fi fs.FileInfo) *ImageInfo {
+	return &ImageInfo{Name: fi.Name(), Size: fi.Size(), ModTime: fi.ModTime()}
+}
+
+// Check creates and removes a temporary file to check that the directory is writable.
+func (s *localImageStore) Check(ctx context.Context) error {
+	f, err := os.CreateTemp(s.dir, ".check-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,172 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config is the configuration of an S3-compatible object storage such as Amazon S3 and MinIO.
+type S3Config struct {
+	// Endpoint is the host (and port) of the storage, e.g. "s3.amazonaws.com" or "localhost:9000".
+	Endpoint string
+	// Bucket is the bucket storing images. It's created if it doesn't exist.
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	// UseSSL connects to the storage with HTTPS.
+	UseSSL bool
+}
+
+// S3ConfigFromEnv reads an S3Config from the environment variables S3_ENDPOINT, S3_BUCKET, S3_REGION,
+// S3_ACCESS_KEY, S3_SECRET_KEY and S3_USE_SSL ("true" to use HTTPS).
+func S3ConfigFromEnv() S3Config {
+	return S3Config{
+		Endpoint:  os.Getenv("S3_ENDPOINT"),
+		Bucket:    os.Getenv("S3_BUCKET"),
+		Region:    os.Getenv("S3_REGION"),
+		AccessKey: os.Getenv("S3_ACCESS_KEY"),
+		SecretKey: os.Getenv("S3_SECRET_KEY"),
+		UseSSL:    os.Getenv("S3_USE_SSL") == "true",
+	}
+}
+
+type s3ImageStore struct {
+	client *minio.Client
+	bucket string
+}
+
+var _ ImageStore = (*s3ImageStore)(nil)
+
+// NewS3ImageStore creates an ImageStore which stores images as objects in a bucket of an S3-compatible storage.
+func NewS3ImageStore(ctx context.Context, cfg S3Config) (ImageStore, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{Region: cfg.Region}); err != nil {
+			return nil, err
+		}
+	}
+	return &s3ImageStore{client: client, bucket: cfg.Bucket}, nil
+}
+
+// Put uploads an image to the bucket.
+func (s *s3ImageStore) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	if err := validateImageName(name); err != nil {
+		return err
+	}
+
+	_, err := s.client.PutObject(ctx, s.bucket, name, r, size, minio.PutObjectOptions{
+		ContentType: mime.TypeByExtension(path.Ext(name)),
+	})
+	return err
+}
+
+// Get opens an image in the bucket.
+// The object is downloaded while it's read, and seeking it starts a new ranged download.
+func (s *s3ImageStore) Get(ctx context.Context, name string) (io.ReadSeekCloser, *ImageInfo, error) {
+	if err := validateImageName(name); err != nil {
+		return nil, nil, err
+	}
+
+	obj, err := s.client.GetObject(ctx, s.bucket, name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, s3Error(err)
+	}
+	// GetObject doesn't send a request until the object is used, so Stat checks that it exists
+	oi, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, nil, s3Error(err)
+	}
+	return obj, newS3ImageInfo(oi), nil
+}
+
+// Stat returns the information of an image in the bucket.
+func (s *s3ImageStore) Stat(ctx context.Context, name string) (*ImageInfo, error) {
+	if err := validateImageName(name); err != nil {
+		return nil, err
+	}
+
+	oi, err := s.client.StatObject(ctx, s.bucket, name, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	return newS3ImageInfo(oi), nil
+}
+
+// Delete removes an image from the bucket.
+func (s *s3ImageStore) Delete(ctx context.Context, name string) error {
+	if err := validateImageName(name); err != nil {
+		return err
+	}
+
+	// S3 doesn't fail to remove objects which don't exist
+	return s.client.RemoveObject(ctx, s.bucket, name, minio.RemoveObjectOptions{})
+}
+
+// List returns the images in the bucket.
+func (s *s3ImageStore) List(ctx context.Context) ([]ImageInfo, error) {
+	var infos []ImageInfo
+	for oi := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{}) {
+		if oi.Err != nil {
+			return nil, oi.Err
+		}
+		// objects which aren't images, such as the ones put by Check
+		if strings.HasPrefix(oi.Key, ".") {
+			continue
+		}
+		infos = append(infos, *newS3ImageInfo(oi))
+	}
+	// S3 lists objects in the order of their keys, but other compatible storages may not
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, nil
+}
+
+// Check puts and removes an object to check that images can be stored in the bucket with the credentials.
+// The key of the object starts with a dot as the temporary files of localImageStore, so that List skips it.
+func (s *s3ImageStore) Check(ctx context.Context) error {
+	b := make([]byte, 16)
+	// rand.Read never returns an error
+	rand.Read(b)
+	key := ".check-" + hex.EncodeToString(b)
+
+	if _, err := s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(nil), 0, minio.PutObjectOptions{}); err != nil {
+		return err
+	}
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+// s3Error converts the error of a missing object into errImageNotFound.
+func s3Error(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return errImageNotFound
+	}
+	return err
+}
+
+func newS3ImageInfo(oi minio.ObjectInfo) *ImageInfo {
+	return &ImageInfo{Name: oi.Key, Size: oi.Size, ModTime: oi.LastModified}
+}
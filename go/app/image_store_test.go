@@ -0,0 +1,147 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/minio/minio-go/v7"
+)
+
+func TestLocalImageStore(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewLocalImageStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create image store: %v", err)
+	}
+	testImageStore(t, store)
+}
+
+func TestSeedDefaultImage(t *testing.T) {
+	t.Parallel()
+	ctx := t.Context()
+
+	store, err := NewLocalImageStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create image store: %v", err)
+	}
+	if err := seedDefaultImage(ctx, store); err != nil {
+		t.Fatalf("failed to seed default image: %v", err)
+	}
+	info, err := store.Stat(ctx, defaultImageName)
+	if err != nil || info.Size != int64(len(defaultImage)) {
+		t.Fatalf("expected the default image to be stored, got %+v, %v", info, err)
+	}
+
+	// the default image replaced by the operator is kept
+	custom := []byte("custom default image")
+	if err := store.Put(ctx, defaultImageName, bytes.NewReader(custom), int64(len(custom))); err != nil {
+		t.Fatalf("failed to put image: %v", err)
+	}
+	if err := seedDefaultImage(ctx, store); err != nil {
+		t.Fatalf("failed to seed default image: %v", err)
+	}
+	if info, err := store.Stat(ctx, defaultImageName); err != nil || info.Size != int64(len(custom)) {
+		t.Errorf("expected the custom default image to be kept, got %+v, %v", info, err)
+	}
+}
+
+// TestS3ImageStoreE2e runs against an S3-compatible storage such as MinIO started by
+// `docker compose --profile s3 up minio`, and is skipped unless S3_TEST_ENDPOINT is set.
+func TestS3ImageStoreE2e(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test")
+	}
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT is not set")
+	}
+
+	store, err := NewS3ImageStore(t.Context(), S3Config{
+		Endpoint:  endpoint,
+		Bucket:    fmt.Sprintf("images-test-%d", time.Now().UnixNano()),
+		AccessKey: os.Getenv("S3_TEST_ACCESS_KEY"),
+		SecretKey: os.Getenv("S3_TEST_SECRET_KEY"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create image store: %v", err)
+	}
+	// objects left by Check when it failed to remove them aren't listed as images
+	s3Store := store.(*s3ImageStore)
+	if _, err := s3Store.client.PutObject(t.Context(), s3Store.bucket, ".check-left", bytes.NewReader(nil), 0, minio.PutObjectOptions{}); err != nil {
+		t.Fatalf("failed to put object: %v", err)
+	}
+	testImageStore(t, store)
+}
+
+// testImageStore checks the behavior every ImageStore must have. The store must be empty.
+func testImageStore(t *testing.T, store ImageStore) {
+	t.Helper()
+	ctx := t.Context()
+
+	images := map[string][]byte{
+		"b.jpg": []byte("second image"),
+		"a.jpg": []byte("first image"),
+	}
+	for name, image := range images {
+		if err := store.Put(ctx, name, bytes.NewReader(image), int64(len(image))); err != nil {
+			t.Fatalf("failed to put %s: %v", name, err)
+		}
+	}
+
+	img, info, err := store.Get(ctx, "a.jpg")
+	if err != nil {
+		t.Fatalf("failed to get image: %v", err)
+	}
+	// GetImage seeks the image to serve Range requests
+	if _, err := img.Seek(6, io.SeekStart); err != nil {
+		t.Fatalf("failed to seek image: %v", err)
+	}
+	got, err := io.ReadAll(img)
+	img.Close()
+	if err != nil {
+		t.Fatalf("failed to read image: %v", err)
+	}
+	if string(got) != "image" || info.Name != "a.jpg" || info.Size != int64(len(images["a.jpg"])) {
+		t.Errorf("unexpected image: %q, %+v", got, info)
+	}
+
+	if err := store.Check(ctx); err != nil {
+		t.Errorf("failed to check store: %v", err)
+	}
+
+	infos, err := store.List(ctx)
+	if err != nil {
+		t.Fatalf("failed to list images: %v", err)
+	}
+	names := []string{}
+	for _, info := range infos {
+		names = append(names, info.Name)
+	}
+	if diff := cmp.Diff([]string{"a.jpg", "b.jpg"}, names); diff != "" {
+		t.Errorf("unexpected images (-want +got):\n%s", diff)
+	}
+
+	if err := store.Delete(ctx, "a.jpg"); err != nil {
+		t.Fatalf("failed to delete image: %v", err)
+	}
+	if err := store.Delete(ctx, "a.jpg"); err != nil {
+		t.Errorf("failed to delete a deleted image: %v", err)
+	}
+	if _, err := store.Stat(ctx, "a.jpg"); !errors.Is(err, errImageNotFound) {
+		t.Errorf("expected errImageNotFound, got %v", err)
+	}
+	if _, _, err := store.Get(ctx, "a.jpg"); !errors.Is(err, errImageNotFound) {
+		t.Errorf("expected errImageNotFound, got %v", err)
+	}
+
+	if err := store.Put(ctx, "../a.jpg", bytes.NewReader(nil), 0); !errors.Is(err, errInvalidImageName) {
+		t.Errorf("expected errInvalidImageName, got %v", err)
+	}
+}
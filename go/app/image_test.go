@@ -0,0 +1,119 @@
+package app
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestDetectImageFormat(t *testing.T) {
+	t.Parallel()
+
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	encode := func(encode func(*bytes.Buffer) error) []byte {
+		var b bytes.Buffer
+		if err := encode(&b); err != nil {
+			t.Fatalf("failed to encode image: %v", err)
+		}
+		return b.Bytes()
+	}
+	jpegImage := encode(func(b *bytes.Buffer) error { return jpeg.Encode(b, img, nil) })
+	pngImage := encode(func(b *bytes.Buffer) error { return png.Encode(b, img) })
+	gifImage := encode(func(b *bytes.Buffer) error { return gif.Encode(b, img, nil) })
+
+	// a PNG claiming to be 100000x100000 pixels
+	bomb := bytes.Clone(pngImage)
+	binary.BigEndian.PutUint32(bomb[16:], 100000)
+	binary.BigEndian.PutUint32(bomb[20:], 100000)
+	binary.BigEndian.PutUint32(bomb[29:], crc32.ChecksumIEEE(bomb[12:29]))
+
+	// animated GIFs of 1000x1000 frames, whose logical screen size is within maxImagePixels
+	frame := image.NewPaletted(image.Rect(0, 0, 1000, 1000), color.Palette{color.Black, color.White})
+	animated := func(frames int) []byte {
+		g := &gif.GIF{}
+		for range frames {
+			g.Image = append(g.Image, frame)
+			g.Delay = append(g.Delay, 10)
+		}
+		return encode(func(b *bytes.Buffer) error { return gif.EncodeAll(b, g) })
+	}
+
+	type wants struct {
+		ext string
+		err error
+	}
+	cases := map[string]struct {
+		data         []byte
+		allowedTypes []string
+		wants
+	}{
+		"ok: jpeg": {
+			data:  jpegImage,
+			wants: wants{ext: ".jpg"},
+		},
+		"ok: png": {
+			data:  pngImage,
+			wants: wants{ext: ".png"},
+		},
+		"ok: gif": {
+			data:  gifImage,
+			wants: wants{ext: ".gif"},
+		},
+		"ok: animated gif": {
+			data:  animated(16),
+			wants: wants{ext: ".gif"},
+		},
+		"ng: too many frames": {
+			data:  animated(17),
+			wants: wants{err: errImageTooLarge},
+		},
+		"ng: gif without trailer": {
+			data:  gifImage[:len(gifImage)-1],
+			wants: wants{err: errUnsupportedImage},
+		},
+		"ng: not an image": {
+			data:  []byte("<html><body>not an image</body></html>"),
+			wants: wants{err: errUnsupportedImage},
+		},
+		"ng: broken image": {
+			data:  pngImage[:20],
+			wants: wants{err: errUnsupportedImage},
+		},
+		"ng: not allowed": {
+			data:         gifImage,
+			allowedTypes: []string{"image/jpeg", "image/png"},
+			wants:        wants{err: errUnsupportedImage},
+		},
+		"ng: decompression bomb": {
+			data:  bomb,
+			wants: wants{err: errImageTooLarge},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			format, err := detectImageFormat(tt.data, tt.allowedTypes)
+			if tt.wants.err != nil {
+				if !errors.Is(err, tt.wants.err) {
+					t.Fatalf("expected error %v, got %v", tt.wants.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if format.Exts[0] != tt.wants.ext {
+				t.Errorf("expected extension %s, got %s", tt.wants.ext, format.Exts[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// This file issues the IDs of the images uploaded with POST /images .
+// Uploading images before the item lets clients retry saving the item without sending the images again.
+// An upload keeps its image from being removed by CollectImages until it expires.
+
+// DefaultImageUploadTTL is the default time an image upload can be referenced.
+const DefaultImageUploadTTL = 24 * time.Hour
+
+// imageUploadIDBytes is the number of random bytes in the ID of an upload.
+// IDs can't be guessed, so that only the client which uploaded an image can reference it.
+const imageUploadIDBytes = 16
+
+// newImageUpload creates an upload of an image stored in the image store, which expires after ttl.
+func newImageUpload(imageName string, ttl time.Duration) (*ImageUpload, error) {
+	b := make([]byte, imageUploadIDBytes)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	return &ImageUpload{
+		ID:        hex.EncodeToString(b),
+		ImageName: imageName,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}, nil
+}
+
+// uploadID rejects a value which isn't the ID of an upload.
+func uploadID(value string) string {
+	if value == "" {
+		return ""
+	}
+	if b, err := hex.DecodeString(value); err != nil || len(b) != imageUploadIDBytes || value != hex.EncodeToString(b) {
+		return "must be the id of an uploaded image"
+	}
+	return ""
+}
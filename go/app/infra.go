@@ -3,27 +3,181 @@ package app
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
+	"log/slog"
+	"strings"
+	"time"
 
 	// STEP 5-1: uncomment this line
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
+// sqliteDriverName is the name of the SQLite driver with the functions this package needs.
+const sqliteDriverName = "sqlite3_mercari"
+
+func init() {
+	sql.Register(sqliteDriverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			// used by migrations to fill the search_* columns (see normalize.go)
+			return conn.RegisterFunc("normalize_search_text", func(s string) string {
+				return searchTokens(normalizeSearchText(s))
+			}, true)
+		},
+	})
+}
+
 var errImageNotFound = errors.New("image not found")
 var errItemNotFound = errors.New("item not found")
+var errInvalidCursor = errors.New("invalid cursor")
+var errImageUploadNotFound = errors.New("image upload not found")
+var errConflict = errors.New("conflicts with the stored data")
+var errFTS5Unavailable = errors.New("SQLite is built without FTS5, build with -tags sqlite_fts5")
+
+// timeLayout is the layout of timestamps stored in the database.
+// It has a fixed width so that timestamps can be compared as strings.
+const timeLayout = "2006-01-02T15:04:05.000Z"
 
+// dbNow returns the current time at the precision of timeLayout,
+// so that the timestamps returned after a write are the same as the ones read from the database later.
+func dbNow() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+// Item is an item stored in the repository.
+// It's not exposed in the API as it is; see ItemV1 for the JSON representation.
 type Item struct {
-	ID        int    `db:"id" json:"-"`
-	Name      string `db:"name" json:"name"`
-	Category  string `db:"category" json:"category"`
-	ImageName string `db:"image_name" json:"image_name"`
+	ID          int       `db:"id"`
+	Name        string    `db:"name"`
+	Category    string    `db:"category"`
+	Images      []string  `db:"images"` // the names of the images in display order
+	Description string    `db:"description"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
 }
 
-// Items 構造体（JSON全体を表す）
+// maxItemImages is the maximum number of images of an item.
+const maxItemImages = 10
+
+// itemColumns are the columns to read an Item with scanItem.
+// Queries selecting them must join categories to items.
+// The images are concatenated with "/", which can't appear in image names (see validateImageName).
+const itemColumns = `items.id, items.name, categories.name AS category,
+	COALESCE((SELECT group_concat(image_name, '/' ORDER BY position) FROM item_images WHERE item_id = items.id), '') AS images,
+	items.description, items.created_at, items.updated_at`
+
+// scanItem reads the itemColumns of a row into item.
+// extra are scanned after the itemColumns.
+func scanItem(row interface{ Scan(dest ...any) error }, item *Item, extra ...any) error {
+	var images string
+	dest := append([]any{&item.ID, &item.Name, &item.Category, &images, &item.Description, &item.CreatedAt, &item.UpdatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+	item.Images = nil
+	if images != "" {
+		item.Images = strings.Split(images, "/")
+	}
+	return nil
+}
+
+// replaceItemImages replaces the images of an item with images in order.
+func replaceItemImages(ctx context.Context, q dbtx, itemID int, images []string) error {
+	if _, err := q.ExecContext(ctx, "DELETE FROM item_images WHERE item_id = ?", itemID); err != nil {
+		return err
+	}
+	for position, name := range images {
+		_, err := q.ExecContext(ctx, "INSERT INTO item_images (item_id, position, image_name) VALUES (?, ?, ?)", itemID, position, name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImageUpload is an image uploaded before the item referencing it is saved.
+// Items can reference the image by the ID until it expires.
+type ImageUpload struct {
+	ID        string    `db:"id"`
+	ImageName string    `db:"image_name"`
+	CreatedAt time.Time `db:"created_at"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+// Items is a list of items read from the repository.
 type Items struct {
-	Items []Item `json:"items"`
+	Items []Item
+	// NextCursor is the cursor to get the next page. It's empty on the last page.
+	NextCursor string
+	// Total is the number of items matching the condition regardless of the pagination.
+	Total int
+}
+
+const (
+	defaultItemsLimit = 20
+	maxItemsLimit     = 100
+)
+
+// SearchHit is an item matching a search query.
+type SearchHit struct {
+	Item
+	// Snippet is the part of the item matching the query, with the matched words enclosed in <mark> tags.
+	Snippet string
+	// Score is the relevance of the item to the query. Higher is more relevant.
+	Score float64
+}
+
+// SearchResults is a list of items matching a search query, ordered by relevance.
+type SearchResults struct {
+	Hits []SearchHit
+}
+
+// ItemQuery is the condition to list items.
+type ItemQuery struct {
+	// Limit is the maximum number of items to return.
+	Limit int
+	// Cursor is the NextCursor returned by the previous page. Empty means the first page.
+	Cursor string
+	// SortBy is one of "id", "name" and "created_at".
+	SortBy string
+	// Order is either "asc" or "desc".
+	Order string
+	// Category filters items by the category name if not empty.
+	Category string
+}
+
+// sortColumns maps ItemQuery.SortBy to the column to sort by.
+var sortColumns = map[string]string{
+	"id":         "items.id",
+	"name":       "items.name",
+	"created_at": "items.created_at",
+}
+
+// itemCursor is the position of the last item of a page.
+// It's encoded as an opaque string so that clients don't depend on its contents.
+type itemCursor struct {
+	SortBy string `json:"s"`
+	Value  string `json:"v"`
+	ID     int    `json:"id"`
+}
+
+func encodeItemCursor(c itemCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeItemCursor(s string) (itemCursor, error) {
+	var c itemCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, errInvalidCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, errInvalidCursor
+	}
+	return c, nil
 }
 
 // Please run `go generate ./...` to generate the mock implementation
@@ -32,9 +186,24 @@ type Items struct {
 //go:generate go run go.uber.org/mock/mockgen -source=$GOFILE -package=${GOPACKAGE} -destination=./mock_$GOFILE
 type ItemRepository interface {
 	Insert(ctx context.Context, item *Item) error
-	GetItems(ctx context.Context) (*Items, error)
+	GetItems(ctx context.Context, query *ItemQuery) (*Items, error)
 	GetItem(ctx context.Context, id string) (*Item, error)
-	SearchItems(ctx context.Context, keyword string) (*Items, error)
+	// GetImageNames returns the names of all the images referenced by items or unexpired uploads.
+	GetImageNames(ctx context.Context) ([]string, error)
+	InsertImageUpload(ctx context.Context, upload *ImageUpload) error
+	GetImageUpload(ctx context.Context, id string) (*ImageUpload, error)
+	// DeleteExpiredImageUploads deletes the uploads expired at now and returns the number of them.
+	DeleteExpiredImageUploads(ctx context.Context, now time.Time) (int64, error)
+	// Update reads an item, changes it with update and writes it in a transaction,
+	// so that concurrent updates of the item don't overwrite each other's changes.
+	// It returns errItemNotFound if no item has the ID, and the error of update as it is.
+	Update(ctx context.Context, id string, update func(item *Item) error) (*Item, error)
+	Delete(ctx context.Context, id string) error
+	SearchItems(ctx context.Context, keyword string, limit int) (*SearchResults, error)
+	// Ping checks that the database is available.
+	Ping(ctx context.Context) error
+	// Stats returns the statistics of the connection pool of the database.
+	Stats() sql.DBStats
 	CloseDB() error
 }
 
@@ -43,109 +212,275 @@ type itemRepository struct {
 	db *sql.DB
 }
 
-// NewItemRepository creates a new itemRepository.
-func NewItemRepository(dbPath string) ItemRepository {
+// OpenDB opens the SQLite database at dbPath.
+// Transactions take the write lock when they begin, so that concurrent writers wait for each other
+// (up to the busy timeout) instead of failing when they try to upgrade their locks.
+func OpenDB(dbPath string) (*sql.DB, error) {
+	sep := "?"
+	if strings.Contains(dbPath, "?") {
+		sep = "&"
+	}
+	dsn := dbPath + sep + "_txlock=immediate&_busy_timeout=5000&_foreign_keys=on"
+
 	// データベースに接続
-	db, err := sql.Open("sqlite3", dbPath)
+	db, err := sql.Open(sqliteDriverName, dsn)
 	if err != nil {
-		fmt.Println("Error opening database:", err)
-		return nil
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
 	}
-	// テーブル作成
-	cmd := `
-	CREATE TABLE IF NOT EXISTS categories (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL UNIQUE
-	);
 
-	CREATE TABLE IF NOT EXISTS items (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL,
-		category_id INTEGER NOT NULL,
-		image_name TEXT NOT NULL,
-		FOREIGN KEY (category_id) REFERENCES categories (id) ON DELETE CASCADE
-	);`
+	// the full-text index of items needs FTS5 (see search.go)
+	var fts5 bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if !fts5 {
+		db.Close()
+		return nil, errFTS5Unavailable
+	}
+	return db, nil
+}
 
-	_, err = db.Exec(cmd)
+// NewItemRepository creates a new itemRepository.
+// It applies the pending migrations, and fails if the database has been migrated by a newer version of the application.
+func NewItemRepository(dbPath string) (ItemRepository, error) {
+	db, err := OpenDB(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
 
+	ctx := context.Background()
+	migrator, err := NewMigrator(db)
 	if err != nil {
-		return nil
+		db.Close()
+		return nil, err
+	}
+	if err := migrator.Up(ctx); err != nil {
+		db.Close()
+		return nil, err
 	}
 
+	return NewItemRepositoryFromDB(db), nil
+}
+
+// NewItemRepositoryFromDB creates a new itemRepository with a database opened by OpenDB, without migrating it.
+// The caller should check the schema with Migrator.CheckLatest.
+func NewItemRepositoryFromDB(db *sql.DB) ItemRepository {
 	return &itemRepository{db: db}
 }
 
-func (i *itemRepository) getCategoryIDFromDB(ctx context.Context, category string) (int, error) {
-	var categoryID int
-	err := i.db.QueryRow("SELECT id FROM categories WHERE name = ?", category).Scan(&categoryID)
-	if err == sql.ErrNoRows {
-		return i.insertCategoryInDB(ctx, category)
+// dbtx is the set of methods shared by *sql.DB and *sql.Tx,
+// so that queries can be run either inside or outside a transaction.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// withTx runs fn in a transaction as a unit of work.
+// The transaction is committed if fn returns nil, and rolled back otherwise.
+func (i *itemRepository) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := i.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
 	}
-	return categoryID, nil
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return conflictError(ctx, err)
+	}
+	return conflictError(ctx, tx.Commit())
+}
+
+// conflictError converts an error of violating a constraint, such as a duplicate ID, into errConflict.
+// The constraint is only logged, since its message tells the schema.
+func conflictError(ctx context.Context, err error) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint {
+		slog.WarnContext(ctx, "constraint violated: ", "error", err)
+		return errConflict
+	}
+	return err
 }
 
-func (i *itemRepository) insertCategoryInDB(ctx context.Context, category string) (int, error) {
-	result, err := i.db.Exec("INSERT INTO categories (name) VALUES (?)", category)
+// getOrCreateCategoryID returns the ID of the category, creating it if it doesn't exist yet.
+func getOrCreateCategoryID(ctx context.Context, q dbtx, category string) (int, error) {
+	// ON CONFLICT keeps the insert from failing on the UNIQUE constraint when the category already exists
+	_, err := q.ExecContext(ctx, "INSERT INTO categories (name, search_name) VALUES (?, ?) ON CONFLICT (name) DO NOTHING", category, searchTokens(normalizeSearchText(category)))
 	if err != nil {
 		return 0, err
 	}
-	categoryID64, err := result.LastInsertId()
+
+	var categoryID int
+	err = q.QueryRowContext(ctx, "SELECT id FROM categories WHERE name = ?", category).Scan(&categoryID)
 	if err != nil {
 		return 0, err
 	}
-	return int(categoryID64), nil
+	return categoryID, nil
+}
+
+// deleteCategoryIfUnused deletes the category if no item refers to it anymore.
+func deleteCategoryIfUnused(ctx context.Context, q dbtx, categoryID int) error {
+	_, err := q.ExecContext(ctx, `
+	DELETE FROM categories
+	WHERE id = ? AND NOT EXISTS (SELECT 1 FROM items WHERE category_id = ?)
+	`, categoryID, categoryID)
+	return err
 }
 
 // Insert inserts an item into the repository.
 func (i *itemRepository) Insert(ctx context.Context, item *Item) error {
 	// STEP 5-1 Insert an item into the database
 	// Set up a transaction to ensure the consistency of the data
-	var categoryID int
-	categoryID, err := i.getCategoryIDFromDB(ctx, item.Category)
-	if err != nil {
-		return err
+	if item.CreatedAt.IsZero() {
+		item.CreatedAt = dbNow()
 	}
+	item.UpdatedAt = item.CreatedAt
 
-	// `items` テーブルにデータを追加（カテゴリIDが確定）
-	_, err = i.db.Exec("INSERT INTO items (name, category_id, image_name) VALUES (?, ?, ?)", item.Name, categoryID, item.ImageName)
-	if err != nil {
-		return err
-	}
+	return i.withTx(ctx, func(tx *sql.Tx) error {
+		categoryID, err := getOrCreateCategoryID(ctx, tx, item.Category)
+		if err != nil {
+			return err
+		}
 
-	return nil
+		// `items` テーブルにデータを追加（カテゴリIDが確定）
+		// the search_* columns are indexed for search (see normalize.go)
+		result, err := tx.ExecContext(ctx, `
+		INSERT INTO items (name, category_id, description, search_name, search_description, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			item.Name, categoryID, item.Description,
+			searchTokens(normalizeSearchText(item.Name)), searchTokens(normalizeSearchText(item.Description)),
+			item.CreatedAt.UTC().Format(timeLayout), item.UpdatedAt.UTC().Format(timeLayout))
+		if err != nil {
+			return err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		item.ID = int(id)
+
+		return replaceItemImages(ctx, tx, item.ID, item.Images)
+	})
 }
 
-// GetItems returns a list of items from the repository.
-func (i *itemRepository) GetItems(ctx context.Context) (*Items, error) {
+// GetItems returns a page of items matching the query from the repository.
+func (i *itemRepository) GetItems(ctx context.Context, query *ItemQuery) (*Items, error) {
 	// STEP 5-1, 5-3: Get items from the database
-	query := `
-	SELECT items.id, items.name, categories.name AS category, items.image_name
-	FROM items 
+	sortColumn, ok := sortColumns[query.SortBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort key: %s", query.SortBy)
+	}
+	desc := query.Order == "desc"
+	limit := query.Limit
+	if limit <= 0 || limit > maxItemsLimit {
+		limit = defaultItemsLimit
+	}
+
+	var conds []string
+	var args []any
+	if query.Category != "" {
+		conds = append(conds, "categories.name = ?")
+		args = append(args, query.Category)
+	}
+
+	var total int
+	countQuery := "SELECT COUNT(*) FROM items INNER JOIN categories ON items.category_id = categories.id"
+	if len(conds) > 0 {
+		countQuery += " WHERE " + strings.Join(conds, " AND ")
+	}
+	if err := i.db.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	// keyset pagination: continue right after the last item of the previous page
+	if query.Cursor != "" {
+		cursor, err := decodeItemCursor(query.Cursor)
+		if err != nil || cursor.SortBy != query.SortBy {
+			return nil, errInvalidCursor
+		}
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		if query.SortBy == "id" {
+			conds = append(conds, "items.id "+op+" ?")
+			args = append(args, cursor.ID)
+		} else {
+			conds = append(conds, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND items.id %[2]s ?))", sortColumn, op))
+			args = append(args, cursor.Value, cursor.Value, cursor.ID)
+		}
+	}
+
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
+	}
+	q := `
+	SELECT ` + itemColumns + `
+	FROM items
 	INNER JOIN categories ON items.category_id = categories.id
 `
-	rows, err := i.db.Query(query)
+	if len(conds) > 0 {
+		q += " WHERE " + strings.Join(conds, " AND ")
+	}
+	if query.SortBy == "id" {
+		q += fmt.Sprintf(" ORDER BY items.id %s", direction)
+	} else {
+		q += fmt.Sprintf(" ORDER BY %[1]s %[2]s, items.id %[2]s", sortColumn, direction)
+	}
+	// fetch one more item to know whether there is a next page
+	q += " LIMIT ?"
+	args = append(args, limit+1)
+
+	rows, err := i.db.QueryContext(ctx, q, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var items Items
+	items := Items{Items: []Item{}, Total: total}
 	for rows.Next() {
 		var item Item
-		err := rows.Scan(&item.ID, &item.Name, &item.Category, &item.ImageName)
-		if err != nil {
+		if err := scanItem(rows, &item); err != nil {
 			return nil, err
 		}
 		items.Items = append(items.Items, item)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(items.Items) > limit {
+		items.Items = items.Items[:limit]
+		last := items.Items[limit-1]
+		cursor := itemCursor{SortBy: query.SortBy, ID: last.ID}
+		switch query.SortBy {
+		case "name":
+			cursor.Value = last.Name
+		case "created_at":
+			cursor.Value = last.CreatedAt.UTC().Format(timeLayout)
+		}
+		items.NextCursor = encodeItemCursor(cursor)
+	}
+
 	return &items, nil
 }
 
 // GetItem returns an item from the repository.
 func (i *itemRepository) GetItem(ctx context.Context, id string) (*Item, error) {
 	// STEP 5-1, 5-3: (Optional) Get a single item from the database
+	return getItem(ctx, i.db, id)
+}
+
+// getItem reads an item by its ID. It returns errItemNotFound if no item has the ID.
+func getItem(ctx context.Context, q dbtx, id string) (*Item, error) {
 	query := `
-	SELECT items.id, items.name, categories.name AS category, items.image_name
+	SELECT ` + itemColumns + `
 	FROM items
 	INNER JOIN categories ON items.category_id = categories.id
 	WHERE items.id = ?
@@ -153,7 +488,7 @@ func (i *itemRepository) GetItem(ctx context.Context, id string) (*Item, error)
 
 	var item Item
 
-	err := i.db.QueryRowContext(ctx, query, id).Scan(&item.ID, &item.Name, &item.Category, &item.ImageName)
+	err := scanItem(q.QueryRowContext(ctx, query, id), &item)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, errItemNotFound
@@ -164,44 +499,224 @@ func (i *itemRepository) GetItem(ctx context.Context, id string) (*Item, error)
 	return &item, nil
 }
 
-// SearchItems returns a list of items that match the query from the repository.
-func (i *itemRepository) SearchItems(ctx context.Context, keyword string) (*Items, error) {
+// GetImageNames returns the names of all the images referenced by items or unexpired uploads in the repository.
+func (i *itemRepository) GetImageNames(ctx context.Context) ([]string, error) {
+	// UNION removes the duplicates
+	rows, err := i.db.QueryContext(ctx, `
+	SELECT image_name FROM item_images
+	UNION
+	SELECT image_name FROM image_uploads WHERE expires_at > ?
+	`, time.Now().UTC().Format(timeLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// InsertImageUpload inserts an image upload into the repository.
+func (i *itemRepository) InsertImageUpload(ctx context.Context, upload *ImageUpload) error {
+	if upload.CreatedAt.IsZero() {
+		upload.CreatedAt = time.Now().UTC()
+	}
+	_, err := i.db.ExecContext(ctx, "INSERT INTO image_uploads (id, image_name, created_at, expires_at) VALUES (?, ?, ?, ?)",
+		upload.ID, upload.ImageName, upload.CreatedAt.UTC().Format(timeLayout), upload.ExpiresAt.UTC().Format(timeLayout))
+	return conflictError(ctx, err)
+}
+
+// GetImageUpload returns an image upload from the repository.
+// It returns errImageUploadNotFound if no upload has the given ID or the upload has expired.
+func (i *itemRepository) GetImageUpload(ctx context.Context, id string) (*ImageUpload, error) {
+	var upload ImageUpload
+	err := i.db.QueryRowContext(ctx, `
+	SELECT id, image_name, created_at, expires_at FROM image_uploads
+	WHERE id = ? AND expires_at > ?
+	`, id, time.Now().UTC().Format(timeLayout)).Scan(&upload.ID, &upload.ImageName, &upload.CreatedAt, &upload.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errImageUploadNotFound
+		}
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// DeleteExpiredImageUploads deletes the image uploads expired at now from the repository.
+func (i *itemRepository) DeleteExpiredImageUploads(ctx context.Context, now time.Time) (int64, error) {
+	result, err := i.db.ExecContext(ctx, "DELETE FROM image_uploads WHERE expires_at <= ?", now.UTC().Format(timeLayout))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Update updates the name, category, images and description of an item changed by update in the repository.
+// It returns errItemNotFound if no item has the given ID.
+func (i *itemRepository) Update(ctx context.Context, id string, update func(item *Item) error) (*Item, error) {
+	var item *Item
+	err := i.withTx(ctx, func(tx *sql.Tx) error {
+		// the transaction takes the write lock when it begins (see _txlock in OpenDB),
+		// so the item isn't changed by others between reading and writing it
+		var oldCategoryID int
+		err := tx.QueryRowContext(ctx, "SELECT category_id FROM items WHERE id = ?", id).Scan(&oldCategoryID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return errItemNotFound
+			}
+			return err
+		}
+		item, err = getItem(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := update(item); err != nil {
+			return err
+		}
+
+		categoryID, err := getOrCreateCategoryID(ctx, tx, item.Category)
+		if err != nil {
+			return err
+		}
+
+		item.UpdatedAt = dbNow()
+		_, err = tx.ExecContext(ctx, `
+		UPDATE items
+		SET name = ?, category_id = ?, description = ?, search_name = ?, search_description = ?, updated_at = ?
+		WHERE id = ?`,
+			item.Name, categoryID, item.Description,
+			searchTokens(normalizeSearchText(item.Name)), searchTokens(normalizeSearchText(item.Description)),
+			item.UpdatedAt.Format(timeLayout), item.ID)
+		if err != nil {
+			return err
+		}
+		if err := replaceItemImages(ctx, tx, item.ID, item.Images); err != nil {
+			return err
+		}
+
+		if oldCategoryID != categoryID {
+			return deleteCategoryIfUnused(ctx, tx, oldCategoryID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// Delete deletes an item from the repository.
+// It returns errItemNotFound if no item has the given ID.
+func (i *itemRepository) Delete(ctx context.Context, id string) error {
+	return i.withTx(ctx, func(tx *sql.Tx) error {
+		var categoryID int
+		err := tx.QueryRowContext(ctx, "SELECT category_id FROM items WHERE id = ?", id).Scan(&categoryID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return errItemNotFound
+			}
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM items WHERE id = ?", id); err != nil {
+			return err
+		}
+
+		// remove the category as well when its last item is gone
+		return deleteCategoryIfUnused(ctx, tx, categoryID)
+	})
+}
+
+// SearchItems returns the items matching the search query from the repository, ordered by relevance.
+// The query must be normalized by normalizeSearchQuery. See buildMatchQuery for its syntax.
+func (i *itemRepository) SearchItems(ctx context.Context, keyword string, limit int) (*SearchResults, error) {
 	// STEP 5-2: Search items from the database using a keyword
+	match, err := buildMatchQuery(keyword)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > maxSearchLimit {
+		limit = defaultSearchLimit
+	}
+
+	// the name matters more than the category, and the category more than the description.
+	// bm25() is lower for more relevant rows, so it's negated into the score.
+	// highlight() marks the matched words with char(1), which tells the columns matching the query.
 	query := `
-	SELECT items.id, items.name, categories.name AS category, items.image_name
-	FROM items
+	SELECT ` + itemColumns + `,
+		-bm25(items_fts, 10.0, 5.0, 1.0) AS score,
+		instr(highlight(items_fts, 0, char(1), ''), char(1)) > 0 AS name_matched,
+		instr(highlight(items_fts, 1, char(1), ''), char(1)) > 0 AS category_matched,
+		instr(highlight(items_fts, 2, char(1), ''), char(1)) > 0 AS description_matched
+	FROM items_fts
+	INNER JOIN items ON items.id = items_fts.rowid
 	INNER JOIN categories ON items.category_id = categories.id
-	WHERE items.name LIKE ?
+	WHERE items_fts MATCH ?
+	ORDER BY score DESC, items.id
+	LIMIT ?
 	`
-	fmt.Println("keyword", keyword)
-	// Add % to the keyword to search for partial matches
-	rows, err := i.db.Query(query, "%"+keyword+"%")
+	slog.DebugContext(ctx, "searching items", "keyword", keyword, "match", match, "limit", limit)
+	rows, err := i.db.QueryContext(ctx, query, match, limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var items Items
+	// the index only has the normalized text, so the snippets are made from the original text
+	terms := searchTerms(keyword)
+	results := SearchResults{Hits: []SearchHit{}}
 	for rows.Next() {
-		var item Item
-		err := rows.Scan(&item.ID, &item.Name, &item.Category, &item.ImageName)
+		var hit SearchHit
+		var nameMatched, categoryMatched, descriptionMatched bool
+		err := scanItem(rows, &hit.Item, &hit.Score, &nameMatched, &categoryMatched, &descriptionMatched)
 		if err != nil {
 			return nil, err
 		}
-		items.Items = append(items.Items, item)
+		// the description is preferred among the columns matching the query, since it shows the context of the match
+		for _, column := range []struct {
+			text    string
+			matched bool
+		}{
+			{hit.Description, descriptionMatched},
+			{hit.Name, nameMatched},
+			{hit.Category, categoryMatched},
+		} {
+			if !column.matched {
+				continue
+			}
+			if snippet, ok := highlightSnippet(column.text, terms); ok {
+				hit.Snippet = snippet
+				break
+			}
+		}
+		results.Hits = append(results.Hits, hit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	return &items, nil
+	return &results, nil
 }
 
-// StoreImage stores an image and returns an error if any.
-// This package doesn't have a related interface for simplicity.
-func StoreImage(fileName string, image []byte) error {
-	// STEP 4-4: add an implementation to store an image
-	if err := os.WriteFile(fileName, image, 0644); err != nil {
-		return err
-	}
-	return nil
+// Ping checks the connection to the database.
+func (i *itemRepository) Ping(ctx context.Context) error {
+	return i.db.PingContext(ctx)
+}
+
+// Stats returns the statistics of the connection pool.
+func (i *itemRepository) Stats() sql.DBStats {
+	return i.db.Stats()
 }
 
 // CloseDB closes the database connection.
@@ -0,0 +1,253 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestInsertConcurrentlyE2e(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test")
+	}
+
+	db, closers, err := setupDB(t)
+	if err != nil {
+		t.Fatalf("failed to set up database: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, c := range closers {
+			c()
+		}
+	})
+
+	repo := &itemRepository{db: db}
+	ctx := t.Context()
+
+	// every goroutine tries to create the same new category at once
+	const n = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- repo.Insert(ctx, &Item{Name: fmt.Sprintf("item %d", i), Category: "new category"})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("failed to insert item: %v", err)
+		}
+	}
+
+	var categories, items int
+	if err := db.QueryRow("SELECT COUNT(*) FROM categories").Scan(&categories); err != nil {
+		t.Fatalf("failed to count categories: %v", err)
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM items").Scan(&items); err != nil {
+		t.Fatalf("failed to count items: %v", err)
+	}
+	if categories != 1 || items != n {
+		t.Errorf("expected 1 category and %d items, got %d categories and %d items", n, categories, items)
+	}
+}
+
+func TestUpdateConcurrentlyE2e(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test")
+	}
+
+	db, closers, err := setupDB(t)
+	if err != nil {
+		t.Fatalf("failed to set up database: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, c := range closers {
+			c()
+		}
+	})
+
+	repo := &itemRepository{db: db}
+	ctx := t.Context()
+
+	item := &Item{Name: "white sneakers", Category: "shoes"}
+	if err := repo.Insert(ctx, item); err != nil {
+		t.Fatalf("failed to insert item: %v", err)
+	}
+	id := strconv.Itoa(item.ID)
+
+	// every goroutine adds a word to the description read, which is lost if another update is written in between
+	const n = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repo.Update(ctx, id, func(item *Item) error {
+				item.Description += fmt.Sprintf(" w%d", i)
+				return nil
+			})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("failed to update item: %v", err)
+		}
+	}
+
+	got, err := repo.GetItem(ctx, id)
+	if err != nil {
+		t.Fatalf("failed to get item: %v", err)
+	}
+	if words := strings.Fields(got.Description); len(words) != n {
+		t.Errorf("expected %d words, got %q", n, got.Description)
+	}
+
+	if _, err := repo.Update(ctx, "0", func(item *Item) error { return nil }); !errors.Is(err, errItemNotFound) {
+		t.Errorf("expected errItemNotFound, got %v", err)
+	}
+}
+
+func TestItemImagesE2e(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test")
+	}
+
+	db, closers, err := setupDB(t)
+	if err != nil {
+		t.Fatalf("failed to set up database: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, c := range closers {
+			c()
+		}
+	})
+
+	repo := &itemRepository{db: db}
+	ctx := t.Context()
+
+	item := &Item{Name: "white sneakers", Category: "shoes", Images: []string{"b.jpg", "a.png", "c.webp"}}
+	if err := repo.Insert(ctx, item); err != nil {
+		t.Fatalf("failed to insert item: %v", err)
+	}
+	got, err := repo.GetItem(ctx, strconv.Itoa(item.ID))
+	if err != nil {
+		t.Fatalf("failed to get item: %v", err)
+	}
+	if diff := cmp.Diff(item.Images, got.Images); diff != "" {
+		t.Errorf("unexpected images (-want +got):\n%s", diff)
+	}
+
+	item, err = repo.Update(ctx, strconv.Itoa(item.ID), func(item *Item) error {
+		item.Images = []string{"c.webp", "b.jpg"}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to update item: %v", err)
+	}
+	got, err = repo.GetItem(ctx, strconv.Itoa(item.ID))
+	if err != nil {
+		t.Fatalf("failed to get item: %v", err)
+	}
+	if diff := cmp.Diff(item.Images, got.Images); diff != "" {
+		t.Errorf("unexpected images (-want +got):\n%s", diff)
+	}
+	// the timestamp returned by Update is the one stored
+	if !got.UpdatedAt.Equal(item.UpdatedAt) {
+		t.Errorf("expected updated_at %v, got %v", item.UpdatedAt, got.UpdatedAt)
+	}
+
+	// the images are deleted with the item
+	if err := repo.Delete(ctx, strconv.Itoa(item.ID)); err != nil {
+		t.Fatalf("failed to delete item: %v", err)
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM item_images").Scan(&count); err != nil {
+		t.Fatalf("failed to count images: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("expected no images, got %d", count)
+	}
+}
+
+func TestImageUploadsE2e(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test")
+	}
+
+	db, closers, err := setupDB(t)
+	if err != nil {
+		t.Fatalf("failed to set up database: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, c := range closers {
+			c()
+		}
+	})
+
+	repo := &itemRepository{db: db}
+	ctx := t.Context()
+
+	now := time.Now().UTC()
+	for _, upload := range []*ImageUpload{
+		{ID: "valid", ImageName: "a.jpg", ExpiresAt: now.Add(time.Hour)},
+		{ID: "expired", ImageName: "b.jpg", ExpiresAt: now.Add(-time.Hour)},
+	} {
+		if err := repo.InsertImageUpload(ctx, upload); err != nil {
+			t.Fatalf("failed to insert image upload: %v", err)
+		}
+	}
+	if err := repo.Insert(ctx, &Item{Name: "white sneakers", Category: "shoes", Images: []string{"a.jpg", "c.jpg"}}); err != nil {
+		t.Fatalf("failed to insert item: %v", err)
+	}
+
+	// an upload with the ID of another upload conflicts
+	if err := repo.InsertImageUpload(ctx, &ImageUpload{ID: "valid", ImageName: "d.jpg", ExpiresAt: now.Add(time.Hour)}); !errors.Is(err, errConflict) {
+		t.Errorf("expected errConflict for a duplicate upload, got %v", err)
+	}
+
+	got, err := repo.GetImageUpload(ctx, "valid")
+	if err != nil {
+		t.Fatalf("failed to get image upload: %v", err)
+	}
+	if got.ImageName != "a.jpg" {
+		t.Errorf("expected a.jpg, got %s", got.ImageName)
+	}
+	if _, err := repo.GetImageUpload(ctx, "expired"); !errors.Is(err, errImageUploadNotFound) {
+		t.Errorf("expected errImageUploadNotFound for an expired upload, got %v", err)
+	}
+
+	// the image of the expired upload isn't referenced
+	names, err := repo.GetImageNames(ctx)
+	if err != nil {
+		t.Fatalf("failed to get image names: %v", err)
+	}
+	slices.Sort(names)
+	if diff := cmp.Diff([]string{"a.jpg", "c.jpg"}, names); diff != "" {
+		t.Errorf("unexpected image names (-want +got):\n%s", diff)
+	}
+
+	n, err := repo.DeleteExpiredImageUploads(ctx, now)
+	if err != nil {
+		t.Fatalf("failed to delete expired image uploads: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 expired upload, got %d", n)
+	}
+}
@@ -0,0 +1,109 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// This file sets up the logger of the server, and adds the ID of the request being handled to the logs.
+// The ID is set to the context of the request by accessLogMiddleware, and the logs written with the context,
+// e.g. slog.ErrorContext(r.Context(), ...), have it as "request_id", so that the logs of a request can be found
+// from the access log or the X-Request-ID header of the response.
+// The logs written while a request is traced also have "trace_id" and "span_id" of the span.
+
+// Log formats selectable by Server.LogFormat.
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// newLogger creates the logger of the server writing the logs at level or above in format to w.
+// The level can be changed while the server is running (see Handlers.SetLogLevel).
+func newLogger(w io.Writer, format string, level *slog.LevelVar) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch format {
+	case "", LogFormatJSON:
+		h = slog.NewJSONHandler(w, opts)
+	case LogFormatText:
+		h = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format: %s", format)
+	}
+	return slog.New(newContextHandler(h)), nil
+}
+
+// requestIDHeader is the header with the ID of a request. The ID sent by a client or a proxy is used if it's valid.
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the maximum length of the request IDs taken from requests.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// withRequestID returns a copy of ctx with the request ID.
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestIDFromContext returns the request ID of ctx, or "" if it has no request ID.
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// newRequestID generates a random request ID.
+func newRequestID() string {
+	b := make([]byte, 16)
+	// rand.Read never returns an error
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID rejects the request IDs which can't be written to the logs and headers as they are.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		// printable ASCII characters except space
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// contextHandler is a slog.Handler adding the request ID and the trace of the context to the records.
+type contextHandler struct {
+	slog.Handler
+}
+
+func newContextHandler(h slog.Handler) slog.Handler {
+	return &contextHandler{Handler: h}
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := requestIDFromContext(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	// the logs can be found from the traces (see tracing.go)
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,111 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestValidRequestID(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		id   string
+		want bool
+	}{
+		"ok: uuid":                  {id: "0f8fad5b-d9cb-469f-a165-70867728950e", want: true},
+		"ok: generated":             {id: newRequestID(), want: true},
+		"ng: empty":                 {id: "", want: false},
+		"ng: too long":              {id: strings.Repeat("a", maxRequestIDLength+1), want: false},
+		"ng: contains a space":      {id: "a b", want: false},
+		"ng: contains a line break": {id: "a\nlevel=ERROR", want: false},
+		"ng: non-ASCII":             {id: "リクエスト", want: false},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := validRequestID(tt.id); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestContextHandler(t *testing.T) {
+	t.Parallel()
+
+	var b bytes.Buffer
+	logger := slog.New(newContextHandler(slog.NewJSONHandler(&b, nil))).With("component", "test")
+
+	logger.InfoContext(withRequestID(context.Background(), "req-1"), "with request ID")
+	logger.InfoContext(context.Background(), "without request ID")
+
+	var logs []map[string]any
+	dec := json.NewDecoder(&b)
+	for dec.More() {
+		var log map[string]any
+		if err := dec.Decode(&log); err != nil {
+			t.Fatalf("failed to decode log: %v", err)
+		}
+		logs = append(logs, log)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("expected 2 logs, got %d", len(logs))
+	}
+	if logs[0]["request_id"] != "req-1" || logs[0]["component"] != "test" {
+		t.Errorf("unexpected log: %v", logs[0])
+	}
+	if _, ok := logs[1]["request_id"]; ok {
+		t.Errorf("unexpected request_id: %v", logs[1])
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		format string
+		want   string
+		err    bool
+	}{
+		"ok: json":           {format: LogFormatJSON, want: `"level":"INFO","msg":"shown"`},
+		"ok: default format": {format: "", want: `"level":"INFO","msg":"shown"`},
+		"ok: text":           {format: LogFormatText, want: "level=INFO msg=shown"},
+		"ng: unknown format": {format: "xml", err: true},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var b bytes.Buffer
+			level := new(slog.LevelVar)
+			logger, err := newLogger(&b, tt.format, level)
+			if err != nil {
+				if !tt.err {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if tt.err {
+				t.Fatal("expected an error")
+			}
+
+			logger.Debug("hidden")
+			logger.Info("shown")
+			// the level is changed at runtime
+			level.Set(slog.LevelDebug)
+			logger.Debug("debug")
+
+			logs := strings.Split(strings.TrimSpace(b.String()), "\n")
+			if len(logs) != 2 || !strings.Contains(logs[0], tt.want) || !strings.Contains(logs[1], "debug") {
+				t.Errorf("unexpected logs: %s", b.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package app
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// This file defines the Prometheus metrics exposed on GET /metrics .
+// For example, the error rate and the ratio of the images already stored are queried by
+//
+//	sum(rate(http_requests_total{code=~"5.."}[5m])) / sum(rate(http_requests_total[5m]))
+//	sum(rate(images_stored_total{result="duplicate"}[5m])) / sum(rate(images_stored_total[5m]))
+
+// routeUnmatched is the route of the requests which don't match any pattern of the mux, such as CORS preflights.
+const routeUnmatched = "unmatched"
+
+// Results of storing an image, for images_stored_total.
+const (
+	imageStoredNew       = "new"
+	imageStoredDuplicate = "duplicate"
+)
+
+// metrics are the collectors updated by the server. The methods do nothing on a nil *metrics,
+// so that handlers can be used without metrics in tests.
+type metrics struct {
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	requestsInFlight prometheus.Gauge
+	uploadBytes      prometheus.Histogram
+	imagesStored     *prometheus.CounterVec
+}
+
+// newMetrics creates the metrics and registers them with reg.
+func newMetrics(reg prometheus.Registerer) *metrics {
+	m := &metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Number of HTTP requests by route pattern and status code.",
+		}, []string{"route", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Latency of HTTP requests by route pattern.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route"}),
+		requestsInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "Number of HTTP requests being served.",
+		}),
+		uploadBytes: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name: "image_upload_bytes",
+			Help: "Size of the uploaded images.",
+			// 1 KiB to 16 MiB
+			Buckets: prometheus.ExponentialBuckets(1<<10, 4, 8),
+		}),
+		imagesStored: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "images_stored_total",
+			Help: "Number of the uploaded images stored, by whether the same image was already stored (duplicate) or not (new).",
+		}, []string{"result"}),
+	}
+	reg.MustRegister(m.requests, m.requestDuration, m.requestsInFlight, m.uploadBytes, m.imagesStored)
+	return m
+}
+
+// registerDBMetrics registers the metrics of the connection pool of the database of repo with reg.
+func registerDBMetrics(reg prometheus.Registerer, repo ItemRepository) {
+	gauge := func(name, help string, value func(s sql.DBStats) float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, func() float64 {
+			return value(repo.Stats())
+		})
+	}
+	counter := func(name, help string, value func(s sql.DBStats) float64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help}, func() float64 {
+			return value(repo.Stats())
+		})
+	}
+	reg.MustRegister(
+		gauge("db_max_open_connections", "Maximum number of open connections to the database.",
+			func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }),
+		gauge("db_open_connections", "Number of established connections to the database.",
+			func(s sql.DBStats) float64 { return float64(s.OpenConnections) }),
+		gauge("db_in_use_connections", "Number of connections currently in use.",
+			func(s sql.DBStats) float64 { return float64(s.InUse) }),
+		gauge("db_idle_connections", "Number of idle connections.",
+			func(s sql.DBStats) float64 { return float64(s.Idle) }),
+		counter("db_wait_count_total", "Number of connections waited for.",
+			func(s sql.DBStats) float64 { return float64(s.WaitCount) }),
+		counter("db_wait_duration_seconds_total", "Time blocked waiting for a new connection.",
+			func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }),
+	)
+}
+
+// newMetricsRegistry creates the registry served on GET /metrics with the metrics of the Go runtime and the process.
+func newMetricsRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return reg
+}
+
+// metricsHandler serves the metrics gathered from reg.
+func metricsHandler(reg *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+}
+
+// middleware records the requests handled by next.
+// next must pass the request to the mux as it is, since the route pattern is read from the request set by the mux.
+func (m *metrics) middleware(next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.requestsInFlight.Inc()
+		defer m.requestsInFlight.Dec()
+
+		start := time.Now()
+		rw := newResponseRecorder(w)
+		next.ServeHTTP(rw, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = routeUnmatched
+		}
+		m.requests.WithLabelValues(route, strconv.Itoa(rw.status)).Inc()
+		m.requestDuration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// observeImageStored records an uploaded image of size bytes, which is a duplicate if the same image was already stored.
+func (m *metrics) observeImageStored(size int, duplicate bool) {
+	if m == nil {
+		return
+	}
+	m.uploadBytes.Observe(float64(size))
+	result := imageStoredNew
+	if duplicate {
+		result = imageStoredDuplicate
+	}
+	m.imagesStored.WithLabelValues(result).Inc()
+}
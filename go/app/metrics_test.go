@@ -0,0 +1,131 @@
+package app
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/mock/gomock"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	t.Parallel()
+
+	m := newMetrics(prometheus.NewRegistry())
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, errItemNotFound)
+	})
+	mux.HandleFunc("GET /items", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	})
+	h := m.middleware(mux)
+
+	for _, path := range []string{"/items/1", "/items/2", "/items", "/unknown"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	cases := map[string]struct {
+		route string
+		code  string
+		want  float64
+	}{
+		"route with a wildcard": {route: "GET /items/{id}", code: "404", want: 2},
+		"route without status":  {route: "GET /items", code: "200", want: 1},
+		"unmatched request":     {route: routeUnmatched, code: "404", want: 1},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := testutil.ToFloat64(m.requests.WithLabelValues(tt.route, tt.code)); got != tt.want {
+				t.Errorf("expected %v requests, got %v", tt.want, got)
+			}
+		})
+	}
+	if got := testutil.CollectAndCount(m.requestDuration); got != 3 {
+		t.Errorf("expected latencies of 3 routes, got %d", got)
+	}
+	if got := testutil.ToFloat64(m.requestsInFlight); got != 0 {
+		t.Errorf("expected no requests in flight, got %v", got)
+	}
+}
+
+func TestStoreImageMetrics(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewLocalImageStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create image store: %v", err)
+	}
+	var b bytes.Buffer
+	if err := png.Encode(&b, image.NewRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatalf("failed to encode image: %v", err)
+	}
+	m := newMetrics(prometheus.NewRegistry())
+	h := &Handlers{images: store, metrics: m}
+
+	// the second image is a duplicate of the first
+	for range 2 {
+		if _, err := h.storeImage(t.Context(), b.Bytes(), nil); err != nil {
+			t.Fatalf("failed to store image: %v", err)
+		}
+	}
+
+	if got := testutil.ToFloat64(m.imagesStored.WithLabelValues(imageStoredNew)); got != 1 {
+		t.Errorf("expected 1 new image, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.imagesStored.WithLabelValues(imageStoredDuplicate)); got != 1 {
+		t.Errorf("expected 1 duplicate image, got %v", got)
+	}
+	want := fmt.Sprintf(`
+# HELP image_upload_bytes Size of the uploaded images.
+# TYPE image_upload_bytes histogram
+image_upload_bytes_bucket{le="1024"} 2
+image_upload_bytes_bucket{le="4096"} 2
+image_upload_bytes_bucket{le="16384"} 2
+image_upload_bytes_bucket{le="65536"} 2
+image_upload_bytes_bucket{le="262144"} 2
+image_upload_bytes_bucket{le="1.048576e+06"} 2
+image_upload_bytes_bucket{le="4.194304e+06"} 2
+image_upload_bytes_bucket{le="1.6777216e+07"} 2
+image_upload_bytes_bucket{le="+Inf"} 2
+image_upload_bytes_sum %d
+image_upload_bytes_count 2
+`, 2*b.Len())
+	if err := testutil.CollectAndCompare(m.uploadBytes, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRegisterDBMetrics(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	mockIR := NewMockItemRepository(ctrl)
+	mockIR.EXPECT().Stats().Return(sql.DBStats{OpenConnections: 3, InUse: 2, Idle: 1, WaitCount: 5}).AnyTimes()
+
+	reg := prometheus.NewRegistry()
+	registerDBMetrics(reg, mockIR)
+
+	want := `
+# HELP db_in_use_connections Number of connections currently in use.
+# TYPE db_in_use_connections gauge
+db_in_use_connections 2
+# HELP db_open_connections Number of established connections to the database.
+# TYPE db_open_connections gauge
+db_open_connections 3
+# HELP db_wait_count_total Number of connections waited for.
+# TYPE db_wait_count_total counter
+db_wait_count_total 5
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "db_in_use_connections", "db_open_connections", "db_wait_count_total"); err != nil {
+		t.Error(err)
+	}
+}
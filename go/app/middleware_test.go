@@ -0,0 +1,90 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestAccessLogMiddleware replaces the default logger, so it must not run in parallel with other tests.
+func TestAccessLogMiddleware(t *testing.T) {
+	var b bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(newContextHandler(slog.NewJSONHandler(&b, nil))))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		slog.InfoContext(r.Context(), "getting item")
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("hello"))
+	})
+	h := accessLogMiddleware(mux)
+
+	cases := map[string]struct {
+		header string
+		// generated is true if the request ID is generated instead of the header.
+		generated bool
+	}{
+		"request ID from the header":     {header: "req-1"},
+		"request ID generated":           {generated: true},
+		"invalid request ID is replaced": {header: "req 1", generated: true},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			b.Reset()
+
+			req := httptest.NewRequest("GET", "/items/1", nil)
+			if tt.header != "" {
+				req.Header.Set(requestIDHeader, tt.header)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			id := rr.Header().Get(requestIDHeader)
+			if tt.generated && (id == tt.header || !validRequestID(id)) {
+				t.Errorf("expected a generated request ID, got %q", id)
+			}
+			if !tt.generated && id != tt.header {
+				t.Errorf("expected request ID %q, got %q", tt.header, id)
+			}
+
+			var logs []map[string]any
+			dec := json.NewDecoder(&b)
+			for dec.More() {
+				var log map[string]any
+				if err := dec.Decode(&log); err != nil {
+					t.Fatalf("failed to decode log: %v", err)
+				}
+				logs = append(logs, log)
+			}
+			if len(logs) != 2 {
+				t.Fatalf("expected 2 logs, got %d", len(logs))
+			}
+			if logs[0]["msg"] != "getting item" || logs[0]["request_id"] != id {
+				t.Errorf("unexpected handler log: %v", logs[0])
+			}
+			access := logs[1]
+			want := map[string]any{
+				"request_id": id,
+				"method":     "GET",
+				"route":      "GET /items/{id}",
+				"path":       "/items/1",
+				"status":     float64(http.StatusTeapot),
+				"bytes":      float64(len("hello")),
+			}
+			for k, v := range want {
+				if access[k] != v {
+					t.Errorf("expected %s %v, got %v", k, v, access[k])
+				}
+			}
+			if _, ok := access["latency_ms"].(float64); !ok {
+				t.Errorf("unexpected latency_ms: %v", access["latency_ms"])
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFS holds the schema migrations.
+// Each migration is a pair of files named `<version>_<name>.up.sql` and `<version>_<name>.down.sql`,
+// where version is a positive integer. Never edit a migration once it's released; add a new one instead.
+//
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+var errSchemaTooNew = errors.New("database schema is newer than this application supports")
+var errSchemaNotLatest = errors.New("database schema isn't at the latest version")
+
+type migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus is the state of a migration in the database.
+type MigrationStatus struct {
+	Version int
+	Name    string
+	// AppliedAt is the time the migration was applied. It's zero if the migration is pending.
+	AppliedAt time.Time
+}
+
+// Migrator applies and rolls back the schema migrations.
+// The applied versions are recorded in the schema_migrations table.
+type Migrator struct {
+	db         *sql.DB
+	migrations []migration
+}
+
+// NewMigrator creates a new Migrator with the migrations embedded in the binary.
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationFS, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// loadMigrations reads the migrations in dir and sorts them by version.
+func loadMigrations(fsys fs.FS, dir string) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*migration{}
+	for _, e := range entries {
+		name := e.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		v, label, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name: %s", name)
+		}
+		version, err := strconv.Atoi(v)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version: %s", name)
+		}
+
+		b, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{Version: version, Name: label}
+			byVersion[version] = m
+		}
+		if m.Name != label {
+			return nil, fmt.Errorf("migration version %d is used by both %s and %s", version, m.Name, label)
+		}
+		if direction == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Latest returns the version of the newest migration known to this application.
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		applied_at DATETIME NOT NULL
+	)`)
+	return err
+}
+
+// Version returns the version of the newest migration applied to the database. It's 0 if none is applied.
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return 0, err
+	}
+	var version int
+	err := m.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// Check returns errSchemaTooNew if the database has been migrated by a newer version of the application.
+func (m *Migrator) Check(ctx context.Context) error {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if version > m.Latest() {
+		return fmt.Errorf("%w: database is at version %d, but the latest known version is %d", errSchemaTooNew, version, m.Latest())
+	}
+	return nil
+}
+
+// CheckLatest returns an error unless all the migrations of this application and no others are applied,
+// for the tools which use the database without migrating it, such as gc-images.
+func (m *Migrator) CheckLatest(ctx context.Context) error {
+	if err := m.Check(ctx); err != nil {
+		return err
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range statuses {
+		known := slices.ContainsFunc(m.migrations, func(mg migration) bool { return mg.Version == s.Version })
+		switch {
+		case !known:
+			return fmt.Errorf("%w: unknown migration %d is applied", errSchemaNotLatest, s.Version)
+		case s.AppliedAt.IsZero():
+			return fmt.Errorf("%w: migration %d_%s is pending", errSchemaNotLatest, s.Version, s.Name)
+		}
+	}
+	return nil
+}
+
+// Up applies all the pending migrations.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.Latest())
+}
+
+// Down rolls back the newest applied migration.
+func (m *Migrator) Down(ctx context.Context) error {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if version == 0 {
+		return nil
+	}
+
+	target := 0
+	for _, mg := range m.migrations {
+		if mg.Version < version {
+			target = mg.Version
+		}
+	}
+	return m.To(ctx, target)
+}
+
+// To migrates the database up or down to the given version.
+func (m *Migrator) To(ctx context.Context, target int) error {
+	if err := m.Check(ctx); err != nil {
+		return err
+	}
+	if target < 0 || target > m.Latest() {
+		return fmt.Errorf("unknown migration version: %d", target)
+	}
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	if target >= version {
+		for _, mg := range m.migrations {
+			if mg.Version <= version || mg.Version > target {
+				continue
+			}
+			if err := m.apply(ctx, mg.Up, "INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)", mg.Version, time.Now().UTC().Format(timeLayout)); err != nil {
+				return fmt.Errorf("failed to apply migration %d_%s: %w", mg.Version, mg.Name, err)
+			}
+		}
+		return nil
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		mg := m.migrations[i]
+		if mg.Version > version || mg.Version <= target {
+			continue
+		}
+		if err := m.apply(ctx, mg.Down, "DELETE FROM schema_migrations WHERE version = ?", mg.Version); err != nil {
+			return fmt.Errorf("failed to roll back migration %d_%s: %w", mg.Version, mg.Name, err)
+		}
+	}
+	return nil
+}
+
+// apply runs the migration script and records it in schema_migrations in a single transaction.
+func (m *Migrator) apply(ctx context.Context, script, record string, args ...any) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Status returns the state of the migrations in the order of versions.
+// Versions applied by a newer version of the application are reported with the name "unknown".
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := m.db.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, mg := range m.migrations {
+		statuses = append(statuses, MigrationStatus{Version: mg.Version, Name: mg.Name, AppliedAt: applied[mg.Version]})
+		delete(applied, mg.Version)
+	}
+	// versions applied by a newer version of the application
+	for version, appliedAt := range applied {
+		statuses = append(statuses, MigrationStatus{Version: version, Name: "unknown", AppliedAt: appliedAt})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
@@ -0,0 +1,170 @@
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestMigrator(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		// prepare sets up the database before running the migrations
+		prepare func(t *testing.T, db *sql.DB)
+		wantErr error
+	}{
+		"ok: empty database": {
+			prepare: func(t *testing.T, db *sql.DB) {},
+		},
+		"ok: database created before migrations": {
+			prepare: func(t *testing.T, db *sql.DB) {
+				_, err := db.Exec(`
+				CREATE TABLE categories (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL UNIQUE);
+				CREATE TABLE items (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, category_id INTEGER NOT NULL, image_name TEXT NOT NULL);
+				INSERT INTO categories (name) VALUES ('phone');
+				INSERT INTO items (name, category_id, image_name) VALUES ('used iPhone 16e', 1, '');`)
+				if err != nil {
+					t.Fatalf("failed to create legacy tables: %v", err)
+				}
+			},
+		},
+		"ng: database migrated by a newer version": {
+			prepare: func(t *testing.T, db *sql.DB) {
+				_, err := db.Exec(`
+				CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY, applied_at DATETIME NOT NULL);
+				INSERT INTO schema_migrations (version, applied_at) VALUES (9999, '2025-04-01T00:00:00.000Z');`)
+				if err != nil {
+					t.Fatalf("failed to record a future migration: %v", err)
+				}
+			},
+			wantErr: errSchemaTooNew,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			f, err := os.CreateTemp(t.TempDir(), "*.sqlite3")
+			if err != nil {
+				t.Fatalf("failed to create database file: %v", err)
+			}
+			f.Close()
+			db, err := OpenDB(f.Name())
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			t.Cleanup(func() { db.Close() })
+			tt.prepare(t, db)
+
+			m, err := NewMigrator(db)
+			if err != nil {
+				t.Fatalf("failed to load migrations: %v", err)
+			}
+
+			ctx := t.Context()
+			err = m.Up(ctx)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to migrate up: %v", err)
+			}
+
+			version, err := m.Version(ctx)
+			if err != nil {
+				t.Fatalf("failed to get version: %v", err)
+			}
+			if version != m.Latest() {
+				t.Errorf("expected version %d, got %d", m.Latest(), version)
+			}
+
+			// every migration must be reversible
+			for v := version; v > 0; v-- {
+				if err := m.Down(ctx); err != nil {
+					t.Fatalf("failed to roll back version %d: %v", v, err)
+				}
+			}
+			if err := m.Up(ctx); err != nil {
+				t.Fatalf("failed to migrate up again: %v", err)
+			}
+
+			statuses, err := m.Status(ctx)
+			if err != nil {
+				t.Fatalf("failed to get status: %v", err)
+			}
+			for _, s := range statuses {
+				if s.AppliedAt.IsZero() {
+					t.Errorf("migration %d_%s is not applied", s.Version, s.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestMigratorCheckLatest(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		// prepare migrates the database before checking it
+		prepare func(t *testing.T, m *Migrator, db *sql.DB)
+		wantErr error
+	}{
+		"ok: latest": {
+			prepare: func(t *testing.T, m *Migrator, db *sql.DB) {
+				if err := m.Up(t.Context()); err != nil {
+					t.Fatalf("failed to migrate up: %v", err)
+				}
+			},
+		},
+		"ng: pending migration": {
+			prepare: func(t *testing.T, m *Migrator, db *sql.DB) {
+				if err := m.To(t.Context(), m.Latest()-1); err != nil {
+					t.Fatalf("failed to migrate: %v", err)
+				}
+			},
+			wantErr: errSchemaNotLatest,
+		},
+		"ng: empty database": {
+			prepare: func(t *testing.T, m *Migrator, db *sql.DB) {},
+			wantErr: errSchemaNotLatest,
+		},
+		"ng: newer database": {
+			prepare: func(t *testing.T, m *Migrator, db *sql.DB) {
+				if err := m.Up(t.Context()); err != nil {
+					t.Fatalf("failed to migrate up: %v", err)
+				}
+				if _, err := db.Exec("INSERT INTO schema_migrations (version, applied_at) VALUES (9999, '2025-04-01T00:00:00.000Z')"); err != nil {
+					t.Fatalf("failed to record a future migration: %v", err)
+				}
+			},
+			wantErr: errSchemaTooNew,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			db, err := OpenDB(t.TempDir() + "/mercari.sqlite3")
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			t.Cleanup(func() { db.Close() })
+			m, err := NewMigrator(db)
+			if err != nil {
+				t.Fatalf("failed to load migrations: %v", err)
+			}
+			tt.prepare(t, m, db)
+
+			if err := m.CheckLatest(t.Context()); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,6 @@
+DROP INDEX idx_items_created_at;
+DROP INDEX idx_items_name;
+DROP INDEX idx_items_category_id;
+
+ALTER TABLE items DROP COLUMN updated_at;
+ALTER TABLE items DROP COLUMN created_at;
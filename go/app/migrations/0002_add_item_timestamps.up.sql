@@ -0,0 +1,10 @@
+-- ALTER TABLE only accepts a constant default, so existing rows are stamped with the time of the migration.
+ALTER TABLE items ADD COLUMN created_at DATETIME NOT NULL DEFAULT '1970-01-01T00:00:00.000Z';
+ALTER TABLE items ADD COLUMN updated_at DATETIME NOT NULL DEFAULT '1970-01-01T00:00:00.000Z';
+UPDATE items SET
+	created_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now'),
+	updated_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now');
+
+CREATE INDEX idx_items_category_id ON items (category_id);
+CREATE INDEX idx_items_name ON items (name, id);
+CREATE INDEX idx_items_created_at ON items (created_at, id);
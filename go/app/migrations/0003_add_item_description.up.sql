@@ -0,0 +1 @@
+ALTER TABLE items ADD COLUMN description TEXT NOT NULL DEFAULT '';
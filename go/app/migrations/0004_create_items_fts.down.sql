@@ -0,0 +1,5 @@
+DROP TRIGGER items_fts_after_category_update;
+DROP TRIGGER items_fts_after_delete;
+DROP TRIGGER items_fts_after_update;
+DROP TRIGGER items_fts_after_insert;
+DROP TABLE items_fts;
@@ -0,0 +1,27 @@
+-- items_fts is the full-text index of items. Its rowid is the id of the item.
+CREATE VIRTUAL TABLE items_fts USING fts5(name, category, description, tokenize='unicode61');
+
+INSERT INTO items_fts (rowid, name, category, description)
+SELECT items.id, items.name, categories.name, items.description
+FROM items
+INNER JOIN categories ON items.category_id = categories.id;
+
+CREATE TRIGGER items_fts_after_insert AFTER INSERT ON items BEGIN
+	INSERT INTO items_fts (rowid, name, category, description)
+	VALUES (new.id, new.name, (SELECT name FROM categories WHERE id = new.category_id), new.description);
+END;
+
+CREATE TRIGGER items_fts_after_update AFTER UPDATE ON items BEGIN
+	DELETE FROM items_fts WHERE rowid = old.id;
+	INSERT INTO items_fts (rowid, name, category, description)
+	VALUES (new.id, new.name, (SELECT name FROM categories WHERE id = new.category_id), new.description);
+END;
+
+CREATE TRIGGER items_fts_after_delete AFTER DELETE ON items BEGIN
+	DELETE FROM items_fts WHERE rowid = old.id;
+END;
+
+CREATE TRIGGER items_fts_after_category_update AFTER UPDATE OF name ON categories BEGIN
+	UPDATE items_fts SET category = new.name
+	WHERE rowid IN (SELECT id FROM items WHERE category_id = new.id);
+END;
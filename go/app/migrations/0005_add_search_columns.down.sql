@@ -0,0 +1,29 @@
+DROP TRIGGER items_fts_after_category_update;
+DROP TRIGGER items_fts_after_update;
+DROP TRIGGER items_fts_after_insert;
+
+DELETE FROM items_fts;
+INSERT INTO items_fts (rowid, name, category, description)
+SELECT items.id, items.name, categories.name, items.description
+FROM items
+INNER JOIN categories ON items.category_id = categories.id;
+
+CREATE TRIGGER items_fts_after_insert AFTER INSERT ON items BEGIN
+	INSERT INTO items_fts (rowid, name, category, description)
+	VALUES (new.id, new.name, (SELECT name FROM categories WHERE id = new.category_id), new.description);
+END;
+
+CREATE TRIGGER items_fts_after_update AFTER UPDATE ON items BEGIN
+	DELETE FROM items_fts WHERE rowid = old.id;
+	INSERT INTO items_fts (rowid, name, category, description)
+	VALUES (new.id, new.name, (SELECT name FROM categories WHERE id = new.category_id), new.description);
+END;
+
+CREATE TRIGGER items_fts_after_category_update AFTER UPDATE OF name ON categories BEGIN
+	UPDATE items_fts SET category = new.name
+	WHERE rowid IN (SELECT id FROM items WHERE category_id = new.id);
+END;
+
+ALTER TABLE items DROP COLUMN search_description;
+ALTER TABLE items DROP COLUMN search_name;
+ALTER TABLE categories DROP COLUMN search_name;
@@ -0,0 +1,36 @@
+-- The search_* columns hold the text normalized for search (see normalize.go), and they are indexed instead of the original text.
+-- The application fills them on insert, and normalize_search_text() is the same normalization registered by OpenDB.
+ALTER TABLE categories ADD COLUMN search_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE items ADD COLUMN search_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE items ADD COLUMN search_description TEXT NOT NULL DEFAULT '';
+
+UPDATE categories SET search_name = normalize_search_text(name);
+UPDATE items SET
+	search_name = normalize_search_text(name),
+	search_description = normalize_search_text(description);
+
+DROP TRIGGER items_fts_after_category_update;
+DROP TRIGGER items_fts_after_update;
+DROP TRIGGER items_fts_after_insert;
+
+DELETE FROM items_fts;
+INSERT INTO items_fts (rowid, name, category, description)
+SELECT items.id, items.search_name, categories.search_name, items.search_description
+FROM items
+INNER JOIN categories ON items.category_id = categories.id;
+
+CREATE TRIGGER items_fts_after_insert AFTER INSERT ON items BEGIN
+	INSERT INTO items_fts (rowid, name, category, description)
+	VALUES (new.id, new.search_name, (SELECT search_name FROM categories WHERE id = new.category_id), new.search_description);
+END;
+
+CREATE TRIGGER items_fts_after_update AFTER UPDATE ON items BEGIN
+	DELETE FROM items_fts WHERE rowid = old.id;
+	INSERT INTO items_fts (rowid, name, category, description)
+	VALUES (new.id, new.search_name, (SELECT search_name FROM categories WHERE id = new.category_id), new.search_description);
+END;
+
+CREATE TRIGGER items_fts_after_category_update AFTER UPDATE OF search_name ON categories BEGIN
+	UPDATE items_fts SET category = new.search_name
+	WHERE rowid IN (SELECT id FROM items WHERE category_id = new.id);
+END;
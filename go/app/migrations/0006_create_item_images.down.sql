@@ -0,0 +1,9 @@
+-- Only the first image of each item is kept.
+ALTER TABLE items ADD COLUMN image_name TEXT NOT NULL DEFAULT '';
+
+UPDATE items SET image_name = COALESCE(
+	(SELECT image_name FROM item_images WHERE item_id = items.id ORDER BY position LIMIT 1),
+	''
+);
+
+DROP TABLE item_images;
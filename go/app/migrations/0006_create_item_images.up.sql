@@ -0,0 +1,14 @@
+-- An item has up to maxItemImages images ordered by position, starting from 0.
+CREATE TABLE item_images (
+	item_id INTEGER NOT NULL,
+	position INTEGER NOT NULL,
+	image_name TEXT NOT NULL,
+	PRIMARY KEY (item_id, position),
+	FOREIGN KEY (item_id) REFERENCES items (id) ON DELETE CASCADE
+);
+CREATE INDEX idx_item_images_image_name ON item_images (image_name);
+
+INSERT INTO item_images (item_id, position, image_name)
+SELECT id, 0, image_name FROM items WHERE image_name != '';
+
+ALTER TABLE items DROP COLUMN image_name;
@@ -0,0 +1,9 @@
+-- An upload is an image uploaded with POST /images, which items can reference by its id until it expires.
+-- The images of unexpired uploads are kept by CollectImages even if no item references them.
+CREATE TABLE image_uploads (
+	id TEXT PRIMARY KEY,
+	image_name TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	expires_at DATETIME NOT NULL
+);
+CREATE INDEX idx_image_uploads_expires_at ON image_uploads (expires_at);
@@ -11,7 +11,9 @@ package app
 
 import (
 	context "context"
+	sql "database/sql"
 	reflect "reflect"
+	time "time"
 
 	gomock "go.uber.org/mock/gomock"
 )
@@ -54,6 +56,65 @@ func (mr *MockItemRepositoryMockRecorder) CloseDB() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CloseDB", reflect.TypeOf((*MockItemRepository)(nil).CloseDB))
 }
 
+// Delete mocks base method.
+func (m *MockItemRepository) Delete(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockItemRepositoryMockRecorder) Delete(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockItemRepository)(nil).Delete), ctx, id)
+}
+
+// DeleteExpiredImageUploads mocks base method.
+func (m *MockItemRepository) DeleteExpiredImageUploads(ctx context.Context, now time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteExpiredImageUploads", ctx, now)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteExpiredImageUploads indicates an expected call of DeleteExpiredImageUploads.
+func (mr *MockItemRepositoryMockRecorder) DeleteExpiredImageUploads(ctx, now any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteExpiredImageUploads", reflect.TypeOf((*MockItemRepository)(nil).DeleteExpiredImageUploads), ctx, now)
+}
+
+// GetImageNames mocks base method.
+func (m *MockItemRepository) GetImageNames(ctx context.Context) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetImageNames", ctx)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetImageNames indicates an expected call of GetImageNames.
+func (mr *MockItemRepositoryMockRecorder) GetImageNames(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetImageNames", reflect.TypeOf((*MockItemRepository)(nil).GetImageNames), ctx)
+}
+
+// GetImageUpload mocks base method.
+func (m *MockItemRepository) GetImageUpload(ctx context.Context, id string) (*ImageUpload, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetImageUpload", ctx, id)
+	ret0, _ := ret[0].(*ImageUpload)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetImageUpload indicates an expected call of GetImageUpload.
+func (mr *MockItemRepositoryMockRecorder) GetImageUpload(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetImageUpload", reflect.TypeOf((*MockItemRepository)(nil).GetImageUpload), ctx, id)
+}
+
 // GetItem mocks base method.
 func (m *MockItemRepository) GetItem(ctx context.Context, id string) (*Item, error) {
 	m.ctrl.T.Helper()
@@ -70,18 +131,18 @@ func (mr *MockItemRepositoryMockRecorder) GetItem(ctx, id any) *gomock.Call {
 }
 
 // GetItems mocks base method.
-func (m *MockItemRepository) GetItems(ctx context.Context) (*Items, error) {
+func (m *MockItemRepository) GetItems(ctx context.Context, query *ItemQuery) (*Items, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetItems", ctx)
+	ret := m.ctrl.Call(m, "GetItems", ctx, query)
 	ret0, _ := ret[0].(*Items)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetItems indicates an expected call of GetItems.
-func (mr *MockItemRepositoryMockRecorder) GetItems(ctx any) *gomock.Call {
+func (mr *MockItemRepositoryMockRecorder) GetItems(ctx, query any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetItems", reflect.TypeOf((*MockItemRepository)(nil).GetItems), ctx)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetItems", reflect.TypeOf((*MockItemRepository)(nil).GetItems), ctx, query)
 }
 
 // Insert mocks base method.
@@ -98,17 +159,157 @@ func (mr *MockItemRepositoryMockRecorder) Insert(ctx, item any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Insert", reflect.TypeOf((*MockItemRepository)(nil).Insert), ctx, item)
 }
 
+// InsertImageUpload mocks base method.
+func (m *MockItemRepository) InsertImageUpload(ctx context.Context, upload *ImageUpload) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertImageUpload", ctx, upload)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertImageUpload indicates an expected call of InsertImageUpload.
+func (mr *MockItemRepositoryMockRecorder) InsertImageUpload(ctx, upload any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertImageUpload", reflect.TypeOf((*MockItemRepository)(nil).InsertImageUpload), ctx, upload)
+}
+
+// Ping mocks base method.
+func (m *MockItemRepository) Ping(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ping", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ping indicates an expected call of Ping.
+func (mr *MockItemRepositoryMockRecorder) Ping(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockItemRepository)(nil).Ping), ctx)
+}
+
 // SearchItems mocks base method.
-func (m *MockItemRepository) SearchItems(ctx context.Context, keyword string) (*Items, error) {
+func (m *MockItemRepository) SearchItems(ctx context.Context, keyword string, limit int) (*SearchResults, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SearchItems", ctx, keyword)
-	ret0, _ := ret[0].(*Items)
+	ret := m.ctrl.Call(m, "SearchItems", ctx, keyword, limit)
+	ret0, _ := ret[0].(*SearchResults)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // SearchItems indicates an expected call of SearchItems.
-func (mr *MockItemRepositoryMockRecorder) SearchItems(ctx, keyword any) *gomock.Call {
+func (mr *MockItemRepositoryMockRecorder) SearchItems(ctx, keyword, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchItems", reflect.TypeOf((*MockItemRepository)(nil).SearchItems), ctx, keyword, limit)
+}
+
+// Stats mocks base method.
+func (m *MockItemRepository) Stats() sql.DBStats {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stats")
+	ret0, _ := ret[0].(sql.DBStats)
+	return ret0
+}
+
+// Stats indicates an expected call of Stats.
+func (mr *MockItemRepositoryMockRecorder) Stats() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*MockItemRepository)(nil).Stats))
+}
+
+// Update mocks base method.
+func (m *MockItemRepository) Update(ctx context.Context, id string, update func(*Item) error) (*Item, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", ctx, id, update)
+	ret0, _ := ret[0].(*Item)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockItemRepositoryMockRecorder) Update(ctx, id, update any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockItemRepository)(nil).Update), ctx, id, update)
+}
+
+// Mockdbtx is a mock of dbtx interface.
+type Mockdbtx struct {
+	ctrl     *gomock.Controller
+	recorder *MockdbtxMockRecorder
+	isgomock struct{}
+}
+
+// MockdbtxMockRecorder is the mock recorder for Mockdbtx.
+type MockdbtxMockRecorder struct {
+	mock *Mockdbtx
+}
+
+// NewMockdbtx creates a new mock instance.
+func NewMockdbtx(ctrl *gomock.Controller) *Mockdbtx {
+	mock := &Mockdbtx{ctrl: ctrl}
+	mock.recorder = &MockdbtxMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *Mockdbtx) EXPECT() *MockdbtxMockRecorder {
+	return m.recorder
+}
+
+// ExecContext mocks base method.
+func (m *Mockdbtx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, query}
+	for _, a := range args {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ExecContext", varargs...)
+	ret0, _ := ret[0].(sql.Result)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExecContext indicates an expected call of ExecContext.
+func (mr *MockdbtxMockRecorder) ExecContext(ctx, query any, args ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, query}, args...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecContext", reflect.TypeOf((*Mockdbtx)(nil).ExecContext), varargs...)
+}
+
+// QueryContext mocks base method.
+func (m *Mockdbtx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, query}
+	for _, a := range args {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "QueryContext", varargs...)
+	ret0, _ := ret[0].(*sql.Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryContext indicates an expected call of QueryContext.
+func (mr *MockdbtxMockRecorder) QueryContext(ctx, query any, args ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, query}, args...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryContext", reflect.TypeOf((*Mockdbtx)(nil).QueryContext), varargs...)
+}
+
+// QueryRowContext mocks base method.
+func (m *Mockdbtx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, query}
+	for _, a := range args {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "QueryRowContext", varargs...)
+	ret0, _ := ret[0].(*sql.Row)
+	return ret0
+}
+
+// QueryRowContext indicates an expected call of QueryRowContext.
+func (mr *MockdbtxMockRecorder) QueryRowContext(ctx, query any, args ...any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchItems", reflect.TypeOf((*MockItemRepository)(nil).SearchItems), ctx, keyword)
+	varargs := append([]any{ctx, query}, args...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryRowContext", reflect.TypeOf((*Mockdbtx)(nil).QueryRowContext), varargs...)
 }
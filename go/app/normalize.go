@@ -0,0 +1,343 @@
+package app
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/width"
+)
+
+// This file normalizes Japanese text for search, so that "ｽﾆｰｶｰ", "スニーカー" and "すにーかー" find the same items.
+// Both the indexed text (the search_* columns) and the keywords are normalized by normalizeSearchText.
+//
+// The FTS tokenizer doesn't split Japanese text into words, so searchTokens splits runs of Japanese characters
+// into overlapping pairs of characters (bigrams), and keywords are searched as phrases of bigrams.
+
+// longVowelMarks are characters used in place of the long vowel mark "ー" after kana.
+var longVowelMarks = map[rune]bool{
+	'-': true, '‐': true, '‑': true, '‒': true, '–': true, '—': true, '―': true,
+	'−': true, '~': true, '～': true, '〜': true, '─': true, '━': true,
+}
+
+// normalizeSearchText normalizes text for search by the following steps:
+//
+//  1. NFKC normalization, which also turns half-width katakana into full-width ("ｽﾆｰｶｰ" → "スニーカー")
+//  2. width folding of the remaining full-width and half-width characters ("ＡＢＣ" → "ABC")
+//  3. case folding ("ABC" → "abc")
+//  4. kana folding of hiragana into katakana ("すにーかー" → "スニーカー")
+//  5. dashes and tildes after kana are replaced with "ー", and repeated "ー" are squashed into one
+func normalizeSearchText(s string) string {
+	var b strings.Builder
+	normalizeSegments(s, func(_ int, normalized string) {
+		b.WriteString(normalized)
+	})
+	return b.String()
+}
+
+// normalizeSegments normalizes s by normalization segments (a character and its combining marks),
+// and calls fn with the byte offset of each segment in s and the normalized text of the segment.
+// The normalized text is empty for characters dropped by the normalization.
+func normalizeSegments(s string, fn func(offset int, normalized string)) {
+	// a Caser keeps state, so it can't be shared between goroutines
+	folder := cases.Fold()
+	var prev rune
+
+	var it norm.Iter
+	it.InitString(norm.NFKC, s)
+	for !it.Done() {
+		offset := it.Pos()
+		segment := width.Fold.String(string(it.Next()))
+		segment = folder.String(segment)
+
+		var b strings.Builder
+		for _, r := range segment {
+			r = foldKana(r)
+			if longVowelMarks[r] && isKana(prev) {
+				r = 'ー'
+			}
+			if r == 'ー' && prev == 'ー' {
+				continue
+			}
+			b.WriteRune(r)
+			prev = r
+		}
+		fn(offset, b.String())
+	}
+}
+
+// foldKana converts hiragana into katakana.
+func foldKana(r rune) rune {
+	switch {
+	case r >= 'ぁ' && r <= 'ゖ', r == 'ゝ' || r == 'ゞ':
+		return r + ('ァ' - 'ぁ')
+	}
+	return r
+}
+
+func isKana(r rune) bool {
+	return unicode.In(r, unicode.Hiragana, unicode.Katakana) || r == 'ー'
+}
+
+// isBigramRune reports whether r is a character of a language written without spaces between words.
+func isBigramRune(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana) || r == 'ー' || r == '々'
+}
+
+// searchTokens splits normalized text into the tokens stored in the full-text index.
+// Runs of Japanese characters are split into bigrams followed by their last character,
+// so that any part of them can be found by a phrase of bigrams (see searchPhrase).
+// Other text is left to the tokenizer of the index.
+func searchTokens(normalized string) string {
+	return strings.Join(splitSearchTokens(normalized, true), " ")
+}
+
+// searchPhrase converts a normalized keyword into the phrase to search for in the full-text index.
+// It reports whether the last token must be searched by prefix, which is the case when the keyword
+// ends with a single Japanese character, as it may be followed by other characters in the index.
+func searchPhrase(normalized string) (phrase string, prefix bool) {
+	tokens := splitSearchTokens(normalized, false)
+	if len(tokens) == 0 {
+		return "", false
+	}
+	runes := []rune(normalized)
+	last := runes[len(runes)-1]
+	prefix = isBigramRune(last) && (len(runes) == 1 || !isBigramRune(runes[len(runes)-2]))
+	return strings.Join(tokens, " "), prefix
+}
+
+// splitSearchTokens splits normalized text into words and bigrams.
+// The last character of a run of Japanese characters is appended as a token after the bigrams
+// unless the run is at the end of the text and atEnd is false.
+func splitSearchTokens(normalized string, atEnd bool) []string {
+	var tokens []string
+	var run []rune
+	var word strings.Builder
+	flushWord := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	flushRun := func(last bool) {
+		if len(run) == 0 {
+			return
+		}
+		for i := 0; i+1 < len(run); i++ {
+			tokens = append(tokens, string(run[i:i+2]))
+		}
+		if !last || atEnd || len(run) == 1 {
+			tokens = append(tokens, string(run[len(run)-1]))
+		}
+		run = run[:0]
+	}
+
+	for _, r := range normalized {
+		if isBigramRune(r) {
+			flushWord()
+			run = append(run, r)
+			continue
+		}
+		flushRun(false)
+		if unicode.IsSpace(r) {
+			flushWord()
+			continue
+		}
+		word.WriteRune(r)
+	}
+	flushWord()
+	flushRun(true)
+	return tokens
+}
+
+// normalizeSearchQuery normalizes the words in a search query, keeping its syntax such as `OR` and quotes.
+func normalizeSearchQuery(query string) string {
+	// fold the width first, so that full-width quotes and spaces work as the syntax
+	query = width.Fold.String(norm.NFKC.String(query))
+
+	var parts []string
+	for _, token := range tokenizeSearchQuery(query) {
+		if !token.quoted && (token.text == "OR" || token.text == "AND") {
+			parts = append(parts, token.text)
+			continue
+		}
+		text := normalizeSearchText(strings.TrimRight(token.text, "*"))
+		if token.quoted {
+			text = `"` + text + `"`
+		}
+		if token.prefix {
+			text += "*"
+		}
+		parts = append(parts, text)
+	}
+	return strings.Join(parts, " ")
+}
+
+// snippetRadius is the number of characters shown before and after the first match in a snippet.
+const snippetRadius = 24
+
+// highlightSnippet returns the part of text around the first match of the normalized terms,
+// escaped as HTML with the matches enclosed in <mark> tags. It reports false if no term matches.
+// Terms match whole words as the full-text index does, so "phone" doesn't match "iPhone",
+// while Japanese terms match any part of a run of Japanese characters.
+func highlightSnippet(text string, terms []searchTerm) (string, bool) {
+	// map each byte of the normalized text back to the start of its segment in text
+	var normalized strings.Builder
+	var offsets []int
+	normalizeSegments(text, func(offset int, segment string) {
+		normalized.WriteString(segment)
+		for range len(segment) {
+			offsets = append(offsets, offset)
+		}
+	})
+	offsets = append(offsets, len(text))
+	tokens := tokenizeNormalized(normalized.String())
+
+	// find the matches as ranges of text
+	type span struct{ start, end int }
+	var spans []span
+	for _, term := range terms {
+		termTokens := tokenizeNormalized(term.text)
+		if len(termTokens) == 0 {
+			continue
+		}
+		for i := range tokens {
+			if matchTokens(tokens[i:], termTokens, term.prefix) {
+				last := tokens[i+len(termTokens)-1]
+				spans = append(spans, span{offsets[tokens[i].start], nextSegment(offsets, last.end)})
+			}
+		}
+	}
+	if len(spans) == 0 {
+		return "", false
+	}
+
+	first := spans[0]
+	for _, s := range spans {
+		if s.start < first.start {
+			first = s
+		}
+	}
+	runes := []rune(text)
+	from := max(0, len([]rune(text[:first.start]))-snippetRadius)
+	to := min(len(runes), len([]rune(text[:first.end]))+snippetRadius)
+	windowStart, windowEnd := len(string(runes[:from])), len(string(runes[:to]))
+
+	// mark every byte in a match, and write the marked runs in <mark> tags
+	marked := make([]bool, len(text))
+	for _, s := range spans {
+		for i := s.start; i < s.end; i++ {
+			marked[i] = true
+		}
+	}
+	var b strings.Builder
+	if windowStart > 0 {
+		b.WriteString("…")
+	}
+	for i := windowStart; i < windowEnd; {
+		j := i
+		for j < windowEnd && marked[j] == marked[i] {
+			j++
+		}
+		if marked[i] {
+			b.WriteString("<mark>" + html.EscapeString(text[i:j]) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(text[i:j]))
+		}
+		i = j
+	}
+	if windowEnd < len(text) {
+		b.WriteString("…")
+	}
+	return b.String(), true
+}
+
+// nextSegment returns the end of the segment containing the byte at end-1 of the normalized text.
+func nextSegment(offsets []int, end int) int {
+	start := offsets[end-1]
+	for i := end; i < len(offsets); i++ {
+		if offsets[i] != start {
+			return offsets[i]
+		}
+	}
+	return offsets[len(offsets)-1]
+}
+
+// textToken is a token of normalized text as the tokenizer of the full-text index splits it.
+type textToken struct {
+	// text is the token without diacritics, which the tokenizer removes.
+	text string
+	// start and end are the byte offsets of the token in the normalized text.
+	start, end int
+	// joined is true for a Japanese character following another one, which the index has as a bigram.
+	joined bool
+}
+
+// tokenizeNormalized splits normalized text into words and Japanese characters.
+// Words are runs of letters and numbers, and other characters separate them.
+func tokenizeNormalized(normalized string) []textToken {
+	var tokens []textToken
+	wordStart := -1
+	flushWord := func(end int) {
+		if wordStart >= 0 {
+			tokens = append(tokens, textToken{text: removeDiacritics(normalized[wordStart:end]), start: wordStart, end: end})
+			wordStart = -1
+		}
+	}
+
+	var prev rune
+	for i, r := range normalized {
+		switch {
+		case isBigramRune(r):
+			flushWord(i)
+			tokens = append(tokens, textToken{text: string(r), start: i, end: i + utf8.RuneLen(r), joined: isBigramRune(prev)})
+		case unicode.In(r, unicode.Letter, unicode.Number, unicode.Mark):
+			if wordStart < 0 {
+				wordStart = i
+			}
+		default:
+			flushWord(i)
+		}
+		prev = r
+	}
+	flushWord(len(normalized))
+	return tokens
+}
+
+// matchTokens reports whether tokens start with the tokens of a term.
+// The last word of the term matches by prefix if prefix is true.
+func matchTokens(tokens, term []textToken, prefix bool) bool {
+	if len(tokens) < len(term) {
+		return false
+	}
+	for i, t := range term {
+		// the characters of a Japanese term must be in the same run as in the term
+		if i > 0 && tokens[i].joined != t.joined {
+			return false
+		}
+		if prefix && i == len(term)-1 {
+			if !strings.HasPrefix(tokens[i].text, t.text) {
+				return false
+			}
+			continue
+		}
+		if tokens[i].text != t.text {
+			return false
+		}
+	}
+	return true
+}
+
+// removeDiacritics removes the diacritics from a word, e.g. "café" → "cafe".
+func removeDiacritics(word string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(word) {
+		if !unicode.Is(unicode.Mn, r) {
+			b.WriteRune(r)
+		}
+	}
+	return norm.NFC.String(b.String())
+}
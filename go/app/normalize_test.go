@@ -0,0 +1,164 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNormalizeSearchText(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		text string
+		want string
+	}{
+		"ok: half-width katakana": {
+			text: "ｽﾆｰｶｰ",
+			want: "スニーカー",
+		},
+		"ok: hiragana": {
+			text: "すにーかー",
+			want: "スニーカー",
+		},
+		"ok: voiced half-width katakana": {
+			text: "ﾊﾞｯｸﾞ",
+			want: "バッグ",
+		},
+		"ok: full-width alphanumerics and case": {
+			text: "ＡＢＣ１２３ Shoes",
+			want: "abc123 shoes",
+		},
+		"ok: dashes after kana are long vowel marks": {
+			text: "スニ-カ〜〜",
+			want: "スニーカー",
+		},
+		"ok: dashes after other characters are kept": {
+			text: "t-shirt",
+			want: "t-shirt",
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if diff := cmp.Diff(tt.want, normalizeSearchText(tt.text)); diff != "" {
+				t.Errorf("unexpected normalized text (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSearchPhrase(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		keyword    string
+		wantPhrase string
+		wantPrefix bool
+	}{
+		"ok: latin word": {
+			keyword:    "iphone",
+			wantPhrase: "iphone",
+		},
+		"ok: japanese word": {
+			keyword:    "スニーカー",
+			wantPhrase: "スニ ニー ーカ カー",
+		},
+		"ok: single japanese character": {
+			keyword:    "靴",
+			wantPhrase: "靴",
+			wantPrefix: true,
+		},
+		"ok: mixed": {
+			keyword:    "白スニーカー27cm",
+			wantPhrase: "白ス スニ ニー ーカ カー ー 27cm",
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			phrase, prefix := searchPhrase(tt.keyword)
+			if phrase != tt.wantPhrase || prefix != tt.wantPrefix {
+				t.Errorf("expected (%q, %v), got (%q, %v)", tt.wantPhrase, tt.wantPrefix, phrase, prefix)
+			}
+		})
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		text   string
+		terms  []searchTerm
+		want   string
+		wantOK bool
+	}{
+		"ok: original text is highlighted": {
+			text:   "ｽﾆｰｶｰ<白>",
+			terms:  []searchTerm{{text: "スニーカー"}},
+			want:   "<mark>ｽﾆｰｶｰ</mark>&lt;白&gt;",
+			wantOK: true,
+		},
+		"ok: long text is cut around the match": {
+			text:   "購入してから半年ほど経ちますが、ほぼ新品です。一度だけ履いたスニーカーですが、サイズが合わなかったため出品します。箱もあります。",
+			terms:  []searchTerm{{text: "サイズ"}},
+			want:   "…、ほぼ新品です。一度だけ履いたスニーカーですが、<mark>サイズ</mark>が合わなかったため出品します。箱もあります。",
+			wantOK: true,
+		},
+		"ok: whole words": {
+			text:   "phone for iPhone, Phone 16",
+			terms:  []searchTerm{{text: "phone"}},
+			want:   "<mark>phone</mark> for iPhone, <mark>Phone</mark> 16",
+			wantOK: true,
+		},
+		"ok: prefix": {
+			text:   "white sneakers",
+			terms:  []searchTerm{{text: "sneak", prefix: true}},
+			want:   "white <mark>sneakers</mark>",
+			wantOK: true,
+		},
+		"ok: phrase": {
+			text:   "case for the phone, cover for the phone",
+			terms:  []searchTerm{{text: "phone cover"}},
+			want:   "case for the <mark>phone, cover</mark> for the phone",
+			wantOK: true,
+		},
+		"ok: diacritics": {
+			text:   "Café latte",
+			terms:  []searchTerm{{text: "cafe"}},
+			want:   "<mark>Café</mark> latte",
+			wantOK: true,
+		},
+		"ng: part of a word": {
+			text:  "used iPhone 16e",
+			terms: []searchTerm{{text: "phone"}},
+		},
+		"ng: Japanese characters in different runs": {
+			text:  "ス ニーカー",
+			terms: []searchTerm{{text: "スニーカー"}},
+		},
+		"ng: no match": {
+			text:  "black boots",
+			terms: []searchTerm{{text: "スニーカー"}},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := highlightSnippet(tt.text, tt.terms)
+			if ok != tt.wantOK {
+				t.Fatalf("expected ok %v, got %v", tt.wantOK, ok)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected snippet (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
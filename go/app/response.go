@@ -0,0 +1,127 @@
+package app
+
+import (
+	"time"
+)
+
+// This file defines the JSON representation of the resources returned by the API.
+// Handlers convert the entities read from the repository into these types,
+// so that changes in the database schema don't leak into (or hide from) the API.
+// When a breaking change is needed, add a new version of the type instead of modifying the existing one.
+
+// defaultImageName is the image returned when an item has no image.
+const defaultImageName = "default.jpg"
+
+// ItemV1 is the representation of an item in version 1 of the API.
+type ItemV1 struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Category    string    `json:"category"`
+	Description string    `json:"description"`
+	ImageURL    string    `json:"image_url"` // the first image, or the default image if the item has no image
+	Images      []ImageV1 `json:"images"`    // all the images in display order
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ImageV1 is the representation of an image of an item in version 1 of the API.
+type ImageV1 struct {
+	// Name identifies the image in PUT /items/{id}/images .
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// ImageUploadV1 is the representation of an image uploaded with POST /images in version 1 of the API.
+type ImageUploadV1 struct {
+	// ID references the image in POST /items until ExpiresAt.
+	ID        string    `json:"id"`
+	Image     ImageV1   `json:"image"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ItemsV1 is the representation of a list of items in version 1 of the API.
+type ItemsV1 struct {
+	Items []ItemV1 `json:"items"`
+	// NextCursor is the cursor to get the next page. It's omitted on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+	// Total is the number of items matching the condition regardless of the pagination.
+	Total int `json:"total"`
+}
+
+// SearchHitV1 is the representation of an item matching a search query in version 1 of the API.
+type SearchHitV1 struct {
+	ItemV1
+	// Snippet is the part of the item matching the query, with the matched words enclosed in <mark> tags.
+	Snippet string  `json:"snippet"`
+	Score   float64 `json:"score"`
+}
+
+// SearchResultsV1 is the representation of search results in version 1 of the API.
+type SearchResultsV1 struct {
+	Items []SearchHitV1 `json:"items"`
+}
+
+// newItemV1 converts an item in the repository into its representation in the API.
+func newItemV1(item *Item) ItemV1 {
+	resp := ItemV1{
+		ID:          item.ID,
+		Name:        item.Name,
+		Category:    item.Category,
+		Description: item.Description,
+		ImageURL:    imageURL(""),
+		Images:      make([]ImageV1, 0, len(item.Images)),
+		CreatedAt:   item.CreatedAt.UTC(),
+		UpdatedAt:   item.UpdatedAt.UTC(),
+	}
+	if len(item.Images) > 0 {
+		resp.ImageURL = imageURL(item.Images[0])
+	}
+	for _, name := range item.Images {
+		resp.Images = append(resp.Images, ImageV1{Name: name, URL: imageURL(name)})
+	}
+	return resp
+}
+
+// newImageUploadV1 converts an image upload in the repository into its representation in the API.
+func newImageUploadV1(upload *ImageUpload) ImageUploadV1 {
+	return ImageUploadV1{
+		ID:        upload.ID,
+		Image:     ImageV1{Name: upload.ImageName, URL: imageURL(upload.ImageName)},
+		ExpiresAt: upload.ExpiresAt.UTC(),
+	}
+}
+
+// newItemsV1 converts a list of items in the repository into its representation in the API.
+func newItemsV1(items *Items) ItemsV1 {
+	resp := ItemsV1{
+		Items:      make([]ItemV1, 0, len(items.Items)),
+		NextCursor: items.NextCursor,
+		Total:      items.Total,
+	}
+	for i := range items.Items {
+		resp.Items = append(resp.Items, newItemV1(&items.Items[i]))
+	}
+	return resp
+}
+
+// newSearchResultsV1 converts search results in the repository into their representation in the API.
+func newSearchResultsV1(results *SearchResults) SearchResultsV1 {
+	resp := SearchResultsV1{Items: make([]SearchHitV1, 0, len(results.Hits))}
+	for i := range results.Hits {
+		hit := &results.Hits[i]
+		resp.Items = append(resp.Items, SearchHitV1{
+			ItemV1:  newItemV1(&hit.Item),
+			Snippet: hit.Snippet,
+			Score:   hit.Score,
+		})
+	}
+	return resp
+}
+
+// imageURL returns the path to get the image from GET /images/{filename} .
+func imageURL(imageName string) string {
+	if imageName == "" {
+		imageName = defaultImageName
+	}
+	return "/images/" + imageName
+}
@@ -0,0 +1,134 @@
+package app
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// This file provides the full-text search over items.
+// Items are indexed in the items_fts table (see migrations), which is kept in sync with items by triggers,
+// and the results are ranked by bm25() of FTS5.
+// FTS5 is only compiled into go-sqlite3 with the sqlite_fts5 build tag, so the server is built with `-tags sqlite_fts5`.
+
+var errInvalidSearchQuery = errors.New("invalid search query")
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+	// maxSearchTerms is the maximum number of terms and phrases in a search query.
+	maxSearchTerms = 16
+)
+
+// buildMatchQuery converts a search query normalized by normalizeSearchQuery into an FTS MATCH expression.
+//
+// Terms separated by spaces must all match, `OR` between terms matches either of them,
+// "double quoted words" match as a phrase, and a trailing `*` matches words by prefix.
+// For example, `iphone case OR "phone cover"` is converted into `("iphone" AND "case") OR ("phone cover")`,
+// and `sneak*` into `("sneak"*)`.
+// Every term is quoted, so that users can't inject other FTS syntax such as column filters.
+// Japanese terms are converted into phrases of bigrams by searchPhrase.
+func buildMatchQuery(query string) (string, error) {
+	var groups [][]string
+	var group []string
+	terms := 0
+	for _, token := range tokenizeSearchQuery(query) {
+		if !token.quoted && token.text == "OR" {
+			if len(group) > 0 {
+				groups = append(groups, group)
+				group = nil
+			}
+			continue
+		}
+		if !token.quoted && token.text == "AND" {
+			continue
+		}
+
+		text, prefix := searchPhrase(strings.TrimSpace(strings.TrimRight(token.text, "*")))
+		if text == "" {
+			continue
+		}
+		term := `"` + text + `"`
+		if token.prefix || prefix {
+			// the last token of the phrase matches by prefix
+			term += "*"
+		}
+
+		terms++
+		if terms > maxSearchTerms {
+			return "", errInvalidSearchQuery
+		}
+		group = append(group, term)
+	}
+	if len(group) > 0 {
+		groups = append(groups, group)
+	}
+	if len(groups) == 0 {
+		return "", errInvalidSearchQuery
+	}
+
+	parts := make([]string, 0, len(groups))
+	for _, g := range groups {
+		parts = append(parts, "("+strings.Join(g, " AND ")+")")
+	}
+	return strings.Join(parts, " OR "), nil
+}
+
+// searchTerm is a word or a phrase in a search query.
+type searchTerm struct {
+	text   string
+	prefix bool // the last word matches by prefix
+}
+
+// searchTerms returns the words and phrases in a search query without the operators.
+func searchTerms(query string) []searchTerm {
+	var terms []searchTerm
+	for _, token := range tokenizeSearchQuery(query) {
+		if !token.quoted && (token.text == "OR" || token.text == "AND") {
+			continue
+		}
+		if text := strings.TrimSpace(strings.TrimRight(token.text, "*")); text != "" {
+			terms = append(terms, searchTerm{text: text, prefix: token.prefix})
+		}
+	}
+	return terms
+}
+
+type searchToken struct {
+	text   string
+	quoted bool // the token is a double quoted phrase
+	prefix bool // the token ends with `*`
+}
+
+// tokenizeSearchQuery splits a search query into words, keeping double quoted phrases together.
+func tokenizeSearchQuery(query string) []searchToken {
+	var tokens []searchToken
+	var current strings.Builder
+	quoted := false
+	flush := func(wasQuoted bool) {
+		if current.Len() > 0 {
+			text := current.String()
+			tokens = append(tokens, searchToken{text: text, quoted: wasQuoted, prefix: strings.HasSuffix(text, "*")})
+			current.Reset()
+		}
+	}
+
+	runes := []rune(query)
+	for i, r := range runes {
+		switch {
+		case r == '"':
+			flush(quoted)
+			// `"phrase"*` searches the last word of the phrase by prefix
+			if quoted && i+1 < len(runes) && runes[i+1] == '*' && len(tokens) > 0 {
+				tokens[len(tokens)-1].prefix = true
+			}
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			flush(false)
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush(quoted)
+	return tokens
+}
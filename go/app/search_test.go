@@ -0,0 +1,194 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBuildMatchQuery(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		query   string
+		want    string
+		wantErr bool
+	}{
+		"ok: single term": {
+			query: "iphone",
+			want:  `("iphone")`,
+		},
+		"ok: terms are combined with AND": {
+			query: "used  iphone",
+			want:  `("used" AND "iphone")`,
+		},
+		"ok: OR binds looser than AND": {
+			query: `iphone case OR "phone cover"`,
+			want:  `("iphone" AND "case") OR ("phone cover")`,
+		},
+		"ok: prefix search": {
+			query: `sneak* "white sne"*`,
+			want:  `("sneak"* AND "white sne"*)`,
+		},
+		"ok: quoted operators are terms": {
+			query: `"OR" AND cat`,
+			want:  `("OR" AND "cat")`,
+		},
+		"ok: FTS syntax is not interpreted": {
+			query: `name:iphone NEAR(a b)`,
+			want:  `("name:iphone" AND "NEAR(a" AND "b)")`,
+		},
+		"ng: only operators": {
+			query:   "OR AND",
+			wantErr: true,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := buildMatchQuery(tt.query)
+			if err != nil {
+				if !tt.wantErr {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatalf("expected an error, got %q", got)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected match query (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSearchItemsE2e(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test")
+	}
+
+	db, closers, err := setupDB(t)
+	if err != nil {
+		t.Fatalf("failed to set up database: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, c := range closers {
+			c()
+		}
+	})
+
+	repo := &itemRepository{db: db}
+	ctx := t.Context()
+	for _, item := range []*Item{
+		{Name: "white sneakers", Category: "shoes", Description: "worn <twice>"},
+		{Name: "black boots", Category: "shoes", Description: "goes well with white sneakers"},
+		{Name: "used iPhone 16e", Category: "phone"},
+		{Name: "ｽﾆｰｶｰ 白 27cm", Category: "靴"},
+	} {
+		if err := repo.Insert(ctx, item); err != nil {
+			t.Fatalf("failed to insert item: %v", err)
+		}
+	}
+	// the index follows updates of items
+	if _, err := repo.Update(ctx, "3", func(item *Item) error {
+		item.Category = "smartphone"
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to update item: %v", err)
+	}
+
+	cases := map[string]struct {
+		query string
+		want  []string
+	}{
+		"ok: matches in the name rank first": {
+			query: "white sneakers",
+			want:  []string{"white sneakers", "black boots"},
+		},
+		"ok: phrase": {
+			query: `"sneakers white"`,
+			want:  []string{},
+		},
+		"ok: OR": {
+			query: "boots OR iphone",
+			// bm25() of FTS5 normalizes by the length of the whole row, which is longer with the description of the boots
+			want: []string{"used iPhone 16e", "black boots"},
+		},
+		"ok: prefix": {
+			query: "iph*",
+			want:  []string{"used iPhone 16e"},
+		},
+		"ok: category": {
+			query: "smartphone",
+			want:  []string{"used iPhone 16e"},
+		},
+		"ok: full-width katakana matches half-width katakana": {
+			query: "スニーカー",
+			want:  []string{"ｽﾆｰｶｰ 白 27cm"},
+		},
+		"ok: hiragana matches katakana": {
+			query: "すにーかー",
+			want:  []string{"ｽﾆｰｶｰ 白 27cm"},
+		},
+		"ok: part of a Japanese word": {
+			query: "ニーカ",
+			want:  []string{"ｽﾆｰｶｰ 白 27cm"},
+		},
+		"ok: single kanji": {
+			query: "靴",
+			want:  []string{"ｽﾆｰｶｰ 白 27cm"},
+		},
+		"ok: full-width alphanumerics": {
+			query: "ＩＰＨＯＮＥ",
+			want:  []string{"used iPhone 16e"},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			results, err := repo.SearchItems(ctx, normalizeSearchQuery(tt.query), 10)
+			if err != nil {
+				t.Fatalf("failed to search items: %v", err)
+			}
+			got := []string{}
+			for _, hit := range results.Hits {
+				got = append(got, hit.Name)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected items (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	results, err := repo.SearchItems(ctx, "twice", 10)
+	if err != nil {
+		t.Fatalf("failed to search items: %v", err)
+	}
+	if len(results.Hits) != 1 || results.Hits[0].Snippet != "worn &lt;<mark>twice</mark>&gt;" {
+		t.Errorf("unexpected snippet: %+v", results.Hits)
+	}
+
+	// the snippet highlights the original text matching the normalized keyword
+	results, err = repo.SearchItems(ctx, normalizeSearchQuery("すにーかー"), 10)
+	if err != nil {
+		t.Fatalf("failed to search items: %v", err)
+	}
+	if len(results.Hits) != 1 || results.Hits[0].Snippet != "<mark>ｽﾆｰｶｰ</mark> 白 27cm" {
+		t.Errorf("unexpected snippet: %+v", results.Hits)
+	}
+
+	// the snippet is made from the column matching the query, and only whole words are highlighted
+	if err := repo.Insert(ctx, &Item{Name: "used iPhone 15", Category: "phone"}); err != nil {
+		t.Fatalf("failed to insert item: %v", err)
+	}
+	results, err = repo.SearchItems(ctx, "phone", 10)
+	if err != nil {
+		t.Fatalf("failed to search items: %v", err)
+	}
+	if len(results.Hits) != 1 || results.Hits[0].Snippet != "<mark>phone</mark>" {
+		t.Errorf("unexpected snippet: %+v", results.Hits)
+	}
+}
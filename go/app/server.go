@@ -1,6 +1,8 @@
 package app
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -8,12 +10,22 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
+	"mime"
 	"net/http"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
+// DefaultShutdownTimeout is the default time to wait for the requests in progress on shutdown.
+const DefaultShutdownTimeout = 30 * time.Second
+
 type Server struct {
 	// Port is the port number to listen on.
 	Port string
@@ -21,55 +33,262 @@ type Server struct {
 	ImageDirPath string
 	// DBPath is the path to the SQLite database file.
 	DBPath string
+	// LogLevel is the minimum level of the logs written. It can be changed by PUT /admin/log-level .
+	LogLevel slog.Level
+	// LogFormat is the format of the logs: LogFormatJSON (default) or LogFormatText.
+	LogFormat string
+	// AdminToken is the bearer token required by the endpoints under /admin/ (see admin.go).
+	// The endpoints aren't served if it's empty.
+	AdminToken string
+	// CORSOrigins are the origins allowed to call the API from browsers. "*" allows any origin.
+	CORSOrigins []string
+	// ImageBackend selects where images are stored: ImageBackendLocal (default) stores them in ImageDirPath,
+	// and ImageBackendS3 stores them in the bucket configured in S3.
+	ImageBackend string
+	// S3 is the configuration of the S3-compatible storage used by ImageBackendS3.
+	S3 S3Config
+	// ImageTypes are the media types of the images accepted on upload, e.g. "image/png".
+	// All the formats in DefaultImageTypes are accepted if empty.
+	ImageTypes []string
+	// ImageGCInterval is the interval to remove the images no longer referenced by items (see CollectImages).
+	// The images aren't removed by the server if it's 0.
+	ImageGCInterval time.Duration
+	// ImageGCGrace is the time an unreferenced image is kept after it was stored. DefaultImageGCGrace is used if it's 0.
+	ImageGCGrace time.Duration
+	// MaxBodyBytes is the maximum size of the body of a request to add or update an item.
+	// DefaultMaxBodyBytes is used if it's 0.
+	MaxBodyBytes int64
+	// MaxImageBytes is the maximum size of an uploaded image. DefaultMaxImageBytes is used if it's 0.
+	MaxImageBytes int64
+	// Categories are the categories items can have. Any category is allowed if empty.
+	Categories []string
+	// ImageUploadTTL is the time an image uploaded with POST /images can be referenced.
+	// DefaultImageUploadTTL is used if it's 0.
+	ImageUploadTTL time.Duration
+	// ReadHeaderTimeout, ReadTimeout, WriteTimeout and IdleTimeout are the timeouts of http.Server .
+	// There are no timeouts if they're 0.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// ShutdownTimeout is the time to wait for the requests in progress when the server is stopped.
+	// DefaultShutdownTimeout is used if it's 0.
+	ShutdownTimeout time.Duration
+	// TraceExporter selects where the spans of requests are exported: TraceExporterNone (default),
+	// TraceExporterStdout or TraceExporterOTLP, which sends them to the collector at OTLPEndpoint.
+	TraceExporter string
+	// OTLPEndpoint is the URL of the OpenTelemetry collector, e.g. "http://localhost:4318".
+	// DefaultOTLPEndpoint is used if it's empty.
+	OTLPEndpoint string
 }
 
 // Run is a method to start the server.
-// This method returns 0 if the server started successfully, and 1 otherwise.
+// The server is stopped gracefully on SIGINT (Ctrl+C) and SIGTERM (e.g. docker stop),
+// and a second signal during the shutdown kills it.
+// This method returns 0 if the server started and stopped successfully, and 1 otherwise.
 func (s Server) Run() int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// the signals are handled by the default behavior again once the shutdown starts,
+	// so that a second Ctrl+C kills the server without waiting for the requests in progress
+	context.AfterFunc(ctx, stop)
+	return s.RunContext(ctx)
+}
+
+// RunContext starts the server and serves requests until ctx is canceled.
+// Then it stops in order: the http server waits for the requests in progress up to ShutdownTimeout,
+// the background workers such as the image GC are stopped, and the database connection is closed.
+func (s Server) RunContext(ctx context.Context) int {
 	// set up logger
-	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
-	slog.SetDefault(logger)
 	// STEP 4-6: set the log level to DEBUG
-	slog.SetLogLoggerLevel(slog.LevelInfo)
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(s.LogLevel)
+	logger, err := newLogger(os.Stderr, s.LogFormat, logLevel)
+	if err != nil {
+		slog.Error("failed to set up the logger: ", "error", err)
+		return 1
+	}
+	slog.SetDefault(logger)
 
-	// set up CORS settings
-	frontURL, found := os.LookupEnv("FRONT_URL")
-	if !found {
-		frontURL = "http://localhost:3000"
+	// set up tracing
+	// the spans are flushed when the server stops, after the database connection is closed
+	tp, shutdownTracing, err := newTracerProvider(context.Background(), s)
+	if err != nil {
+		slog.Error("failed to set up tracing: ", "error", err)
+		return 1
 	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("failed to flush spans: ", "error", err)
+		}
+	}()
 
 	// STEP 5-1: set up the database connection
 	// set up handlers
-	itemRepo := NewItemRepository(s.DBPath)
-	// close the database connection when the server stops
+	itemRepo, err := NewItemRepository(s.DBPath)
+	if err != nil {
+		slog.Error("failed to set up the database: ", "error", err)
+		return 1
+	}
+	// close the database connection when the server stops, after the workers below are stopped
 	defer itemRepo.CloseDB()
-	h := &Handlers{imgDirPath: s.ImageDirPath, itemRepo: itemRepo}
+
+	images, err := NewImageStore(context.Background(), s)
+	if err != nil {
+		slog.Error("failed to set up the image store: ", "error", err)
+		return 1
+	}
+	if err := seedDefaultImage(context.Background(), images); err != nil {
+		slog.Error("failed to store the default image: ", "error", err)
+		return 1
+	}
+
+	// set up metrics
+	reg := newMetricsRegistry()
+	m := newMetrics(reg)
+	registerDBMetrics(reg, itemRepo)
+
+	// the repository used by handlers and workers traces the queries
+	tracedRepo := newTracedItemRepository(itemRepo, tp)
+
+	h := &Handlers{
+		images:        images,
+		imageTypes:    s.ImageTypes,
+		maxBodyBytes:  s.MaxBodyBytes,
+		maxImageBytes: s.MaxImageBytes,
+		categories:    s.Categories,
+		uploadTTL:     s.ImageUploadTTL,
+		itemRepo:      tracedRepo,
+		metrics:       m,
+		logLevel:      logLevel,
+		adminToken:    s.AdminToken,
+	}
+
+	// run the background workers until the server stops, and wait for them before the database is closed
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	defer func() {
+		stopWorkers()
+		workers.Wait()
+	}()
+
+	// remove unreferenced images in the background
+	if s.ImageGCInterval > 0 {
+		grace := s.ImageGCGrace
+		if grace == 0 {
+			grace = DefaultImageGCGrace
+		}
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			runImageGC(workerCtx, tracedRepo, images, s.ImageGCInterval, ImageGCOptions{Grace: grace})
+		}()
+	}
 
 	// set up routes
+	// each handler has a span named after the method of Handlers (see tracing.go)
 	mux := http.NewServeMux()
-	mux.HandleFunc("GET /", h.Hello)
-	mux.HandleFunc("POST /items", h.AddItem)
-	mux.HandleFunc("GET /items", h.GetItems)     // 4-3: add a new route
-	mux.HandleFunc("GET /items/{id}", h.GetItem) // 4-5: add a new route
-	mux.HandleFunc("GET /images/{filename}", h.GetImage)
+	mux.Handle("GET /", traceHandler(tp, "Hello", h.Hello))
+	mux.HandleFunc("GET /healthz", h.Healthz)
+	mux.HandleFunc("GET /readyz", h.Readyz)
+	mux.HandleFunc("GET /version", h.Version)
+	mux.Handle("GET /metrics", metricsHandler(reg))
+	if s.AdminToken != "" {
+		mux.HandleFunc("GET /admin/log-level", h.requireAdmin(h.GetLogLevel))
+		mux.HandleFunc("PUT /admin/log-level", h.requireAdmin(h.SetLogLevel))
+	}
+	mux.Handle("POST /items", traceHandler(tp, "AddItem", h.AddItem))
+	mux.Handle("GET /items", traceHandler(tp, "GetItems", h.GetItems))    // 4-3: add a new route
+	mux.Handle("GET /items/{id}", traceHandler(tp, "GetItem", h.GetItem)) // 4-5: add a new route
+	mux.Handle("PUT /items/{id}", traceHandler(tp, "UpdateItem", h.UpdateItem))
+	mux.Handle("PATCH /items/{id}", traceHandler(tp, "UpdateItem", h.UpdateItem))
+	mux.Handle("DELETE /items/{id}", traceHandler(tp, "DeleteItem", h.DeleteItem))
+	mux.Handle("PUT /items/{id}/images", traceHandler(tp, "UpdateItemImages", h.UpdateItemImages))
+	mux.Handle("POST /images", traceHandler(tp, "UploadImage", h.UploadImage))
+	mux.Handle("GET /images/{filename}", traceHandler(tp, "GetImage", h.GetImage))
+	mux.Handle("GET /images/{filename}/thumb", traceHandler(tp, "GetImageThumbnail", h.GetImageThumbnail))
 
-	mux.HandleFunc("GET /search", h.SearchItems) // 5-2 add a new rote for search
+	mux.Handle("GET /search", traceHandler(tp, "SearchItems", h.SearchItems)) // 5-2 add a new rote for search
 
 	// start the server
 	slog.Info("http server started on", "port", s.Port)
-	err := http.ListenAndServe(":"+s.Port, simpleCORSMiddleware(simpleLoggerMiddleware(mux), frontURL, []string{"GET", "HEAD", "POST", "OPTIONS"}))
-	if err != nil {
+	srv := &http.Server{
+		Addr:              ":" + s.Port,
+		Handler:           tracingMiddleware(accessLogMiddleware(m.middleware(simpleCORSMiddleware(mux, s.CORSOrigins, []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}))), tp),
+		ReadHeaderTimeout: s.ReadHeaderTimeout,
+		ReadTimeout:       s.ReadTimeout,
+		WriteTimeout:      s.WriteTimeout,
+		IdleTimeout:       s.IdleTimeout,
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
 		slog.Error("failed to start server: ", "error", err)
 		return 1
+	case <-ctx.Done():
 	}
 
+	// stop accepting new connections and wait for the requests in progress
+	timeout := s.ShutdownTimeout
+	if timeout == 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	slog.Info("shutting down http server", "timeout", timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		// the requests still in progress are cut
+		slog.Error("failed to shut down http server gracefully: ", "error", err)
+		srv.Close()
+		return 1
+	}
+
+	slog.Info("http server stopped")
 	return 0
 }
 
 type Handlers struct {
-	// imgDirPath is the path to the directory storing images.
-	imgDirPath string
-	itemRepo   ItemRepository
+	// images stores the images of items.
+	images ImageStore
+	// imageTypes are the media types of the images accepted on upload. DefaultImageTypes are accepted if empty.
+	imageTypes []string
+	// maxBodyBytes and maxImageBytes limit the size of uploads. The defaults are used if they're 0.
+	maxBodyBytes  int64
+	maxImageBytes int64
+	// categories are the categories items can have. Any category is allowed if empty.
+	categories []string
+	// uploadTTL is the time an image upload can be referenced. The default is used if it's 0.
+	uploadTTL time.Duration
+	itemRepo  ItemRepository
+	// metrics records the uploaded images. Nothing is recorded if it's nil.
+	metrics *metrics
+	// logLevel is the level of the logger of the server, which is changed by SetLogLevel.
+	logLevel *slog.LevelVar
+	// adminToken is the token required by the endpoints under /admin/.
+	adminToken string
+}
+
+// limitBody limits the size of the request body to maxBodyBytes.
+func (s *Handlers) limitBody(w http.ResponseWriter, r *http.Request) {
+	limit := s.maxBodyBytes
+	if limit == 0 {
+		limit = DefaultMaxBodyBytes
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+}
+
+// imageLimit returns the maximum size of an uploaded image.
+func (s *Handlers) imageLimit() int64 {
+	if s.maxImageBytes == 0 {
+		return DefaultMaxImageBytes
+	}
+	return s.maxImageBytes
 }
 
 type HelloResponse struct {
@@ -81,15 +300,32 @@ func (s *Handlers) Hello(w http.ResponseWriter, r *http.Request) {
 	resp := HelloResponse{Message: "Hello, world!"}
 	err := json.NewEncoder(w).Encode(resp)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 }
 
 type AddItemRequest struct {
-	Name     string `form:"name"`
-	Category string `form:"category"` // STEP 4-2: add a category field
-	Image    []byte `form:"image"`    // STEP 4-4: add an image field
+	Name        string           `form:"name"`
+	Category    string           `form:"category"` // STEP 4-2: add a category field
+	Images      []*uploadedImage `form:"image"`    // STEP 4-4: add an image field
+	Description string           `form:"description"`
+}
+
+// AddItemJSONRequest is the body of the request to add an item sent as application/json.
+type AddItemJSONRequest struct {
+	Name        string             `json:"name"`
+	Category    string             `json:"category"`
+	Description string             `json:"description"`
+	Images      []AddItemJSONImage `json:"images"`
+}
+
+// AddItemJSONImage is an image of an item sent as JSON. Either Data or ID must be set.
+type AddItemJSONImage struct {
+	// Data is the content of the image encoded in base64.
+	Data []byte `json:"data"`
+	// ID is the ID of an image uploaded with POST /images , which can be used until it expires.
+	ID string `json:"id"`
 }
 
 type AddItemResponse struct {
@@ -97,67 +333,159 @@ type AddItemResponse struct {
 }
 
 // parseAddItemRequest parses and validates the request to add an item.
-func parseAddItemRequest(r *http.Request) (*AddItemRequest, error) {
-	req := &AddItemRequest{
-		Name:     r.FormValue("name"),
-		Category: r.FormValue("category"),
-		Image:    []byte(r.FormValue("image")),
+// The body is either a form (multipart/form-data or application/x-www-form-urlencoded) or AddItemJSONRequest.
+// The category must be one of categories unless it's empty.
+// The images in the request are stored in temporary files, which the caller must remove with removeUploadedImages.
+func parseAddItemRequest(r *http.Request, maxImageBytes int64, categories []string) (*AddItemRequest, error) {
+	var req *AddItemRequest
+	var err error
+	switch mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType {
+	case "application/json":
+		req, err = decodeAddItemJSON(r, maxImageBytes)
+	case "multipart/form-data", "application/x-www-form-urlencoded", "":
+		req, err = decodeAddItemForm(r, maxImageBytes)
+	default:
+		err = unsupportedContentType(mediaType)
 	}
-
-	// STEP 4-4: add an image field
-
-	// validate the request
-	if req.Name == "" {
-		return nil, errors.New("name is required")
+	if err != nil {
+		return nil, err
 	}
+	req.Name = strings.TrimSpace(req.Name)
+	req.Category = strings.TrimSpace(req.Category)
+	req.Description = strings.TrimSpace(req.Description)
 
+	// validate the request
 	// STEP 4-2: validate the category field
-	if req.Category == "" {
-		return nil, errors.New("category is required")
+	v := &validator{}
+	v.check("name", req.Name, required)
+	v.check("category", req.Category, required)
+	checkItemFields(v, &req.Name, &req.Category, &req.Description, categories)
+	if err := v.err(); err != nil {
+		removeUploadedImages(r.Context(), req.Images)
+		return nil, err
 	}
-	// STEP 4-4: validate the image field
-	// `image` フィールドを取得
-	file, _, err := r.FormFile("image")
-	// image is optional
+
+	return req, nil
+}
+
+// decodeAddItemForm reads the request to add an item sent as a form.
+func decodeAddItemForm(r *http.Request, maxImageBytes int64) (*AddItemRequest, error) {
+	form, err := parseUploadForm(r, maxImageBytes)
 	if err != nil {
-		slog.Info("failed to get image file: ", "error", err)
-		req.Image = nil
-		return req, nil
+		return nil, err
+	}
+	return &AddItemRequest{
+		Name:        form.Values.Get("name"),
+		Category:    form.Values.Get("category"),
+		Description: form.Values.Get("description"),
+		// STEP 4-4: add an image field
+		// images are optional
+		Images: form.Images,
+	}, nil
+}
+
+// decodeAddItemJSON reads the request to add an item sent as AddItemJSONRequest.
+// The images sent as base64 are written to temporary files as the uploaded files are.
+func decodeAddItemJSON(r *http.Request, maxImageBytes int64) (*AddItemRequest, error) {
+	var body AddItemJSONRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode request body: %w", bodyError(r, err))
+	}
+
+	v := &validator{}
+	checkJSONImages(v, body.Images)
+	if err := v.err(); err != nil {
+		return nil, err
 	}
-	defer file.Close()
 
-	// 画像データをバイト配列に変換
-	imageBytes, err := io.ReadAll(file)
+	images, err := saveJSONImages(r.Context(), body.Images, maxImageBytes)
 	if err != nil {
-		return nil, errors.New("failed to read image file")
+		return nil, err
 	}
-	req.Image = imageBytes
+	return &AddItemRequest{
+		Name:        body.Name,
+		Category:    body.Category,
+		Description: body.Description,
+		Images:      images,
+	}, nil
+}
 
-	return req, nil
+// checkJSONImages checks the images of an item sent as JSON.
+func checkJSONImages(v *validator, images []AddItemJSONImage) {
+	if len(images) > maxItemImages {
+		v.add("images", fmt.Sprintf("must have at most %d images", maxItemImages))
+	}
+	for i, img := range images {
+		field := fmt.Sprintf("images[%d]", i)
+		switch {
+		case (img.Data == nil) == (img.ID == ""):
+			v.add(field, "must have either data or id")
+		default:
+			v.check(field+".id", img.ID, uploadID)
+		}
+	}
+}
+
+// saveJSONImages writes the images sent as base64 to temporary files as the uploaded files are,
+// and returns them with the images referenced by the IDs of uploads.
+func saveJSONImages(ctx context.Context, images []AddItemJSONImage, maxImageBytes int64) ([]*uploadedImage, error) {
+	var saved []*uploadedImage
+	for _, img := range images {
+		if img.ID != "" {
+			saved = append(saved, &uploadedImage{uploadID: img.ID})
+			continue
+		}
+		u, err := saveUploadedImage(bytes.NewReader(img.Data), maxImageBytes)
+		if err != nil {
+			removeUploadedImages(ctx, saved)
+			return nil, err
+		}
+		saved = append(saved, u)
+	}
+	return saved, nil
+}
+
+// unsupportedContentType returns the error for a request body of a media type which isn't accepted.
+func unsupportedContentType(mediaType string) error {
+	return &apiError{Code: codeUnsupportedMedia, Err: fmt.Errorf("unsupported content type %s", mediaType)}
+}
+
+// checkItemFields checks the fields of an item sent in a request. nil fields are the ones not sent.
+func checkItemFields(v *validator, name, category, description *string, categories []string) {
+	if name != nil {
+		v.check("name", *name, maxLength(maxItemNameLength), singleLine)
+	}
+	if category != nil {
+		v.check("category", *category, maxLength(maxItemCategoryLength), singleLine, oneOf(categories...))
+	}
+	if description != nil {
+		v.check("description", *description, maxLength(maxItemDescriptionLength), multiLine)
+	}
 }
 
 // AddItem is a handler to add a new item for POST /items .
 func (s *Handlers) AddItem(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	req, err := parseAddItemRequest(r)
+	s.limitBody(w, r)
+	req, err := parseAddItemRequest(r, s.imageLimit(), s.categories)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		slog.WarnContext(r.Context(), "failed to parse add item request: ", "error", err)
+		writeError(w, r, validationError(err))
 		return
 	}
+	defer removeUploadedImages(r.Context(), req.Images)
 
 	// STEP 4-4: uncomment on adding an implementation to store an image
-	var filename string
-	if len(req.Image) > 0 {
-		var err error
-		filename, err = s.storeImage(req.Image)
-		if err != nil {
-			slog.Error("failed to store image: ", "error", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+	filenames, err := s.storeImages(ctx, req.Images)
+	if err != nil {
+		if !isImageRejected(err) {
+			slog.ErrorContext(r.Context(), "failed to store image: ", "error", err)
 		}
-	} else {
-		filename = ""
+		writeError(w, r, err)
+		return
 	}
 
 	item := &Item{
@@ -165,70 +493,219 @@ func (s *Handlers) AddItem(w http.ResponseWriter, r *http.Request) {
 		// STEP 4-2: add a category field
 		Category: req.Category,
 		// STEP 4-4: add an image field
-		ImageName: filename,
+		Images:      filenames,
+		Description: req.Description,
 	}
 	message := fmt.Sprintf("item received: %s, category: %s", item.Name, item.Category)
-	slog.Info(message)
+	slog.InfoContext(r.Context(), message)
 
 	// STEP 4-2: add an implementation to store an image
 	err = s.itemRepo.Insert(ctx, item)
 	if err != nil {
-		slog.Error("failed to store item: ", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "failed to store item: ", "error", err)
+		writeError(w, r, err)
 		return
 	}
 
 	resp := AddItemResponse{Message: message}
 	err = json.NewEncoder(w).Encode(resp)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 }
 
-// storeImage stores an image and returns the file path and an error if any.
+// storeImage stores an image and returns the file name and an error if any.
 // this method calculates the hash sum of the image as a file name to avoid the duplication of a same file
-// and stores it in the image directory.
-func (s *Handlers) storeImage(image []byte) (filePath string, err error) {
+// and stores it in the image store with the extension of the format detected from the content.
+// Metadata such as EXIF is removed from the image before it's stored (see sanitizeImage).
+// It returns errUnsupportedImage or errImageTooLarge if the image isn't acceptable.
+// sum is the SHA-256 hash of image if it's already computed, or nil.
+func (s *Handlers) storeImage(ctx context.Context, image []byte, sum []byte) (fileName string, err error) {
+	format, err := detectImageFormat(image, s.imageTypes)
+	if err != nil {
+		return "", err
+	}
+	// the hash is computed over the sanitized image, so that the same upload is still stored once
+	sanitized, err := sanitizeImage(ctx, image, format)
+	if err != nil {
+		return "", err
+	}
+
 	// 1. ハッシュを計算（SHA-256）
-	hash := sha256.Sum256(image)
-	hashString := hex.EncodeToString(hash[:]) // 16進数の文字列に変換
+	// the hash computed while uploading can be used when the image had no metadata
+	if sum == nil || !bytes.Equal(sanitized, image) {
+		hash := sha256.Sum256(sanitized)
+		sum = hash[:]
+	}
+	image = sanitized
+	hashString := hex.EncodeToString(sum) // 16進数の文字列に変換
+
+	fileName = hashString + format.Exts[0]
 
-	fileName := filepath.Join(hashString + ".jpg")
-	if err := os.MkdirAll(s.imgDirPath, os.ModePerm); err != nil {
+	// 2. 画像を保存
+	// the image is written even if the same image exists, so that its modification time is renewed
+	// and CollectImages doesn't remove it before the item referencing it is saved
+	duplicate := false
+	if s.metrics != nil {
+		_, err := s.images.Stat(ctx, fileName)
+		duplicate = err == nil
+	}
+	if err := s.images.Put(ctx, fileName, bytes.NewReader(image), int64(len(image))); err != nil {
 		return "", err
 	}
+	s.metrics.observeImageStored(len(image), duplicate)
+
+	// 3. 保存したファイルの名前を返す
+	return fileName, nil
+}
+
+// openImage opens an image, or its variant resized to width if width isn't 0.
+// Variants are generated on the first request and kept in the image store.
+func (s *Handlers) openImage(ctx context.Context, name string, width int) (io.ReadSeekCloser, *ImageInfo, error) {
+	if width == 0 {
+		return s.images.Get(ctx, name)
+	}
+
+	variantName := imageVariantName(name, width)
+	img, info, err := s.images.Get(ctx, variantName)
+	if !errors.Is(err, errImageNotFound) {
+		return img, info, err
+	}
+
+	original, _, err := s.images.Get(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer original.Close()
+
+	variant, err := resizeImage(original, width, variantName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resize %s: %w", name, err)
+	}
+	// concurrent requests may generate the same variant, but Put replaces it atomically
+	if err := s.images.Put(ctx, variantName, bytes.NewReader(variant), int64(len(variant))); err != nil {
+		return nil, nil, err
+	}
+	return s.images.Get(ctx, variantName)
+}
 
-	// 2. 画像の保存先パスを生成
-	filePath = filepath.Join(s.imgDirPath, fileName)
+// storeImages stores images with storeImage and returns their file names in order.
+// The images referenced by the IDs of uploads aren't stored again, but the uploads must not have expired.
+// The same image sent twice is only stored and returned once.
+func (s *Handlers) storeImages(ctx context.Context, images []*uploadedImage) ([]string, error) {
+	var fileNames []string
+	for i, u := range images {
+		fileName, err := s.storeUploadedImage(ctx, u)
+		if errors.Is(err, errImageUploadNotFound) {
+			return nil, fieldErrors{{Field: fmt.Sprintf("images[%d].id", i), Message: "is not found or has expired"}}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(fileNames, fileName) {
+			fileNames = append(fileNames, fileName)
+		}
+	}
+	return fileNames, nil
+}
 
-	// 3. 同じハッシュの画像がすでに存在するのかをチェックする
-	if _, err := os.Stat(filePath); err == nil {
-		return fileName, nil
+// storeUploadedImage stores an image sent in a request with storeImage and returns the file name.
+// For an image referenced by the ID of an upload, it returns the name of the image already stored.
+func (s *Handlers) storeUploadedImage(ctx context.Context, u *uploadedImage) (string, error) {
+	if u.uploadID != "" {
+		upload, err := s.itemRepo.GetImageUpload(ctx, u.uploadID)
+		if err != nil {
+			return "", err
+		}
+		return upload.ImageName, nil
 	}
 
-	// 4. 画像を保存
-	if err := StoreImage(filePath, image); err != nil {
+	image, err := u.ReadAll()
+	if err != nil {
 		return "", err
 	}
+	return s.storeImage(ctx, image, u.sum)
+}
 
-	// 5. 保存したファイルのパスを返す
-	return fileName, nil
+// isImageRejected reports whether an error from storeImages is caused by the images sent by the client.
+func isImageRejected(err error) bool {
+	var fieldErrs fieldErrors
+	return errors.Is(err, errUnsupportedImage) || errors.Is(err, errImageTooLarge) || errors.As(err, &fieldErrs)
+}
+
+type GetItemsRequest struct {
+	Limit    int    // query parameter "limit"
+	Cursor   string // query parameter "cursor"
+	Sort     string // query parameter "sort"
+	Order    string // query parameter "order"
+	Category string // query parameter "category"
+}
+
+// parseGetItemsRequest parses and validates the request to get a list of items.
+func parseGetItemsRequest(r *http.Request) (*GetItemsRequest, error) {
+	q := r.URL.Query()
+	req := &GetItemsRequest{
+		Limit:    defaultItemsLimit,
+		Cursor:   q.Get("cursor"),
+		Sort:     q.Get("sort"),
+		Order:    q.Get("order"),
+		Category: strings.TrimSpace(q.Get("category")),
+	}
+
+	// validate the request
+	v := &validator{}
+	v.check("limit", q.Get("limit"), intRange(1, maxItemsLimit))
+	v.check("sort", req.Sort, oneOf(slices.Sorted(maps.Keys(sortColumns))...))
+	v.check("order", req.Order, oneOf("asc", "desc"))
+	v.check("category", req.Category, maxLength(maxItemCategoryLength))
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	if limit := q.Get("limit"); limit != "" {
+		req.Limit, _ = strconv.Atoi(limit)
+	}
+	if req.Sort == "" {
+		req.Sort = "id"
+	}
+	if req.Order == "" {
+		req.Order = "asc"
+	}
+
+	return req, nil
 }
 
 // GetItems is a handler to return a list of items for GET /items .
 func (s *Handlers) GetItems(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	items, err := s.itemRepo.GetItems(ctx)
+	req, err := parseGetItemsRequest(r)
 	if err != nil {
-		slog.Error("failed to get items: ", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		slog.WarnContext(r.Context(), "failed to parse get items request: ", "error", err)
+		writeError(w, r, validationError(err))
 		return
 	}
 
-	if err := json.NewEncoder(w).Encode(items); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	items, err := s.itemRepo.GetItems(ctx, &ItemQuery{
+		Limit:    req.Limit,
+		Cursor:   req.Cursor,
+		SortBy:   req.Sort,
+		Order:    req.Order,
+		Category: req.Category,
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidCursor) {
+			writeError(w, r, err)
+			return
+		}
+		slog.ErrorContext(r.Context(), "failed to get items: ", "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(newItemsV1(items)); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
@@ -245,8 +722,10 @@ func parseGetItemRequest(r *http.Request) (*GetItemRequest, error) {
 	}
 
 	// validate the request
-	if req.ID == "" {
-		return nil, errors.New("id is required")
+	v := &validator{}
+	v.check("id", req.ID, required, positiveInt)
+	if err := v.err(); err != nil {
+		return nil, err
 	}
 
 	return req, nil
@@ -258,26 +737,420 @@ func (s *Handlers) GetItem(w http.ResponseWriter, r *http.Request) {
 
 	req, err := parseGetItemRequest(r)
 	if err != nil {
-		slog.Error("failed to parse get item request: ", "error", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		slog.ErrorContext(r.Context(), "failed to parse get item request: ", "error", err)
+		writeError(w, r, validationError(err))
 		return
 	}
 
 	item, err := s.itemRepo.GetItem(ctx, req.ID)
 	if err != nil {
-		slog.Error("failed to get item: ", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if errors.Is(err, errItemNotFound) {
+			writeError(w, r, err)
+			return
+		}
+		slog.ErrorContext(r.Context(), "failed to get item: ", "error", err)
+		writeError(w, r, err)
 		return
 	}
 
-	if err := json.NewEncoder(w).Encode(item); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := json.NewEncoder(w).Encode(newItemV1(item)); err != nil {
+		writeError(w, r, err)
+		return
+	}
+}
+
+type UpdateItemRequest struct {
+	ID          string           // path value
+	Name        *string          `form:"name"`        // nil when the field is not sent
+	Category    *string          `form:"category"`    // nil when the field is not sent
+	Images      []*uploadedImage `form:"image"`       // empty when no image is sent
+	Description *string          `form:"description"` // nil when the field is not sent
+}
+
+// UpdateItemJSONRequest is the body of the request to update an item sent as application/json.
+// The fields not sent are nil, and the current images are kept when no image is sent.
+type UpdateItemJSONRequest struct {
+	Name        *string            `json:"name"`
+	Category    *string            `json:"category"`
+	Description *string            `json:"description"`
+	Images      []AddItemJSONImage `json:"images"`
+}
+
+// parseUpdateItemRequest parses and validates the request to update an item.
+// The body is either a form (multipart/form-data or application/x-www-form-urlencoded) or UpdateItemJSONRequest.
+// A PUT request must have all the fields except the image, while a PATCH request only needs the fields to change.
+// The category must be one of categories unless it's empty.
+// The images in the request are stored in temporary files, which the caller must remove with removeUploadedImages.
+func parseUpdateItemRequest(r *http.Request, maxImageBytes int64, categories []string) (*UpdateItemRequest, error) {
+	id := r.PathValue("id")
+
+	// validate the request
+	v := &validator{}
+	v.check("id", id, required, positiveInt)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	var req *UpdateItemRequest
+	var err error
+	switch mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType {
+	case "application/json":
+		req, err = decodeUpdateItemJSON(r, maxImageBytes)
+	case "multipart/form-data", "application/x-www-form-urlencoded", "":
+		req, err = decodeUpdateItemForm(r, maxImageBytes)
+	default:
+		err = unsupportedContentType(mediaType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.ID = id
+	for _, field := range []*string{req.Name, req.Category, req.Description} {
+		if field != nil {
+			*field = strings.TrimSpace(*field)
+		}
+	}
+
+	if err := validateUpdateItemRequest(r.Method, req, categories); err != nil {
+		removeUploadedImages(r.Context(), req.Images)
+		return nil, err
+	}
+	return req, nil
+}
+
+// decodeUpdateItemForm reads the request to update an item sent as a form.
+func decodeUpdateItemForm(r *http.Request, maxImageBytes int64) (*UpdateItemRequest, error) {
+	form, err := parseUploadForm(r, maxImageBytes)
+	if err != nil {
+		return nil, err
+	}
+	// images are optional, the current images are kept when none is sent
+	req := &UpdateItemRequest{Images: form.Images}
+
+	if values, ok := form.Values["name"]; ok {
+		req.Name = &values[0]
+	}
+	if values, ok := form.Values["category"]; ok {
+		req.Category = &values[0]
+	}
+	if values, ok := form.Values["description"]; ok {
+		req.Description = &values[0]
+	}
+	return req, nil
+}
+
+// decodeUpdateItemJSON reads the request to update an item sent as UpdateItemJSONRequest.
+func decodeUpdateItemJSON(r *http.Request, maxImageBytes int64) (*UpdateItemRequest, error) {
+	var body UpdateItemJSONRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode request body: %w", bodyError(r, err))
+	}
+
+	v := &validator{}
+	checkJSONImages(v, body.Images)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	images, err := saveJSONImages(r.Context(), body.Images, maxImageBytes)
+	if err != nil {
+		return nil, err
+	}
+	return &UpdateItemRequest{
+		Name:        body.Name,
+		Category:    body.Category,
+		Description: body.Description,
+		Images:      images,
+	}, nil
+}
+
+// validateUpdateItemRequest validates the fields of the request to update an item.
+func validateUpdateItemRequest(method string, req *UpdateItemRequest, categories []string) error {
+	v := &validator{}
+	// the name and the category can't be removed, so they must not be empty if sent
+	if req.Name != nil || method == http.MethodPut {
+		v.check("name", deref(req.Name), required)
+	}
+	if req.Category != nil || method == http.MethodPut {
+		v.check("category", deref(req.Category), required)
+	}
+	checkItemFields(v, req.Name, req.Category, req.Description, categories)
+	return v.err()
+}
+
+// deref returns the string p points to, or "" if p is nil.
+func deref(p *string) string {
+	if p == nil {
+		return ""
+	}
+	return *p
+}
+
+// UpdateItem is a handler to update an item for PUT /items/{id} and PATCH /items/{id} .
+func (s *Handlers) UpdateItem(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	s.limitBody(w, r)
+	req, err := parseUpdateItemRequest(r, s.imageLimit(), s.categories)
+	if err != nil {
+		slog.WarnContext(r.Context(), "failed to parse update item request: ", "error", err)
+		writeError(w, r, validationError(err))
+		return
+	}
+	defer removeUploadedImages(r.Context(), req.Images)
+
+	// the images are stored before the item is updated, so that the item isn't locked while they're stored.
+	// they're removed by the image GC if the item isn't found.
+	var images []string
+	if len(req.Images) > 0 {
+		images, err = s.storeImages(ctx, req.Images)
+		if err != nil {
+			if !isImageRejected(err) {
+				slog.ErrorContext(r.Context(), "failed to store image: ", "error", err)
+			}
+			writeError(w, r, err)
+			return
+		}
+	}
+
+	item, err := s.itemRepo.Update(ctx, req.ID, func(item *Item) error {
+		if req.Name != nil {
+			item.Name = *req.Name
+		}
+		if req.Category != nil {
+			item.Category = *req.Category
+		}
+		if req.Description != nil {
+			item.Description = *req.Description
+		}
+		if len(images) > 0 {
+			// the images sent replace all the current images
+			item.Images = images
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errItemNotFound) {
+			writeError(w, r, err)
+			return
+		}
+		slog.ErrorContext(r.Context(), "failed to update item: ", "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(newItemV1(item)); err != nil {
+		writeError(w, r, err)
+		return
+	}
+}
+
+type UpdateItemImagesRequest struct {
+	ID string // path value
+	// Images are the names of the current images of the item in the new order.
+	// The images not included are removed from the item.
+	Images []string `json:"images"`
+}
+
+// parseUpdateItemImagesRequest parses and validates the request to reorder and remove the images of an item.
+func parseUpdateItemImagesRequest(r *http.Request) (*UpdateItemImagesRequest, error) {
+	req := &UpdateItemImagesRequest{
+		ID: r.PathValue("id"),
+	}
+
+	// validate the request
+	v := &validator{}
+	v.check("id", req.ID, required, positiveInt)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(req); err != nil {
+		return nil, fmt.Errorf("failed to decode request body: %w", bodyError(r, err))
+	}
+	if req.Images == nil {
+		v.add("images", "is required")
+	}
+	for i, name := range req.Images {
+		if slices.Contains(req.Images[:i], name) {
+			v.add(fmt.Sprintf("images[%d]", i), fmt.Sprintf("duplicates image %s", name))
+		}
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// UpdateItemImages is a handler to reorder and remove the images of an item for PUT /items/{id}/images .
+// New images are added with PUT /items/{id} and PATCH /items/{id} .
+func (s *Handlers) UpdateItemImages(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	s.limitBody(w, r)
+	req, err := parseUpdateItemImagesRequest(r)
+	if err != nil {
+		slog.WarnContext(r.Context(), "failed to parse update item images request: ", "error", err)
+		writeError(w, r, validationError(err))
+		return
+	}
+
+	item, err := s.itemRepo.Update(ctx, req.ID, func(item *Item) error {
+		// only the current images can be ordered, so that other items' images can't be attached
+		for _, name := range req.Images {
+			if !slices.Contains(item.Images, name) {
+				return validationError(fmt.Errorf("image %s is not an image of the item", name))
+			}
+		}
+		item.Images = req.Images
+		return nil
+	})
+	if err != nil {
+		var apiErr *apiError
+		if errors.Is(err, errItemNotFound) || errors.As(err, &apiErr) {
+			writeError(w, r, err)
+			return
+		}
+		slog.ErrorContext(r.Context(), "failed to update item: ", "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(newItemV1(item)); err != nil {
+		writeError(w, r, err)
+		return
+	}
+}
+
+type DeleteItemRequest struct {
+	ID string // path value
+}
+
+// parseDeleteItemRequest parses and validates the request to delete an item.
+func parseDeleteItemRequest(r *http.Request) (*DeleteItemRequest, error) {
+	req := &DeleteItemRequest{
+		ID: r.PathValue("id"),
+	}
+
+	// validate the request
+	v := &validator{}
+	v.check("id", req.ID, required, positiveInt)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// DeleteItem is a handler to delete an item for DELETE /items/{id} .
+func (s *Handlers) DeleteItem(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	req, err := parseDeleteItemRequest(r)
+	if err != nil {
+		slog.WarnContext(r.Context(), "failed to parse delete item request: ", "error", err)
+		writeError(w, r, validationError(err))
+		return
+	}
+
+	err = s.itemRepo.Delete(ctx, req.ID)
+	if err != nil {
+		if errors.Is(err, errItemNotFound) {
+			writeError(w, r, err)
+			return
+		}
+		slog.ErrorContext(r.Context(), "failed to delete item: ", "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type UploadImageRequest struct {
+	Image *uploadedImage `form:"image"`
+}
+
+// parseUploadImageRequest parses and validates the request to upload an image.
+// The image is stored in a temporary file, which the caller must remove with removeUploadedImages.
+func parseUploadImageRequest(r *http.Request, maxImageBytes int64) (*UploadImageRequest, error) {
+	form, err := parseUploadForm(r, maxImageBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	// validate the request
+	v := &validator{}
+	switch len(form.Images) {
+	case 0:
+		v.add("image", "is required")
+	case 1:
+	default:
+		v.add("image", "must be a single file")
+	}
+	if err := v.err(); err != nil {
+		removeUploadedImages(r.Context(), form.Images)
+		return nil, err
+	}
+
+	return &UploadImageRequest{Image: form.Images[0]}, nil
+}
+
+// UploadImage is a handler to upload an image for POST /images .
+// It returns the ID of the upload, which POST /items accepts instead of the image until it expires.
+func (s *Handlers) UploadImage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	s.limitBody(w, r)
+	req, err := parseUploadImageRequest(r, s.imageLimit())
+	if err != nil {
+		slog.WarnContext(r.Context(), "failed to parse upload image request: ", "error", err)
+		writeError(w, r, validationError(err))
+		return
+	}
+	defer removeUploadedImages(r.Context(), []*uploadedImage{req.Image})
+
+	filenames, err := s.storeImages(ctx, []*uploadedImage{req.Image})
+	if err != nil {
+		if !isImageRejected(err) {
+			slog.ErrorContext(r.Context(), "failed to store image: ", "error", err)
+		}
+		writeError(w, r, err)
+		return
+	}
+
+	ttl := s.uploadTTL
+	if ttl == 0 {
+		ttl = DefaultImageUploadTTL
+	}
+	upload, err := newImageUpload(filenames[0], ttl)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to create image upload: ", "error", err)
+		writeError(w, r, err)
+		return
+	}
+	if err := s.itemRepo.InsertImageUpload(ctx, upload); err != nil {
+		slog.ErrorContext(r.Context(), "failed to store image upload: ", "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(newImageUploadV1(upload)); err != nil {
+		slog.ErrorContext(r.Context(), "failed to write response: ", "error", err)
 		return
 	}
 }
 
 type GetImageRequest struct {
 	FileName string // path value
+	// Width is the width of the resized variant to return, or 0 for the original image.
+	Width int // query parameter "w"
 }
 
 // parseGetImageRequest parses and validates the request to get an image.
@@ -290,82 +1163,137 @@ func parseGetImageRequest(r *http.Request) (*GetImageRequest, error) {
 	if req.FileName == "" {
 		return nil, errors.New("filename is required")
 	}
+	if err := validateImageName(req.FileName); err != nil {
+		return nil, err
+	}
+	// validate the image suffix
+	if imageFormatByName(req.FileName) == nil {
+		return nil, fmt.Errorf("image path does not end with an image extension: %s", req.FileName)
+	}
+	if w := r.URL.Query().Get("w"); w != "" {
+		width, err := strconv.Atoi(w)
+		if err != nil || !isImageVariantWidth(width) {
+			return nil, fmt.Errorf("w must be one of %v", imageVariantWidths)
+		}
+		req.Width = width
+	}
 
 	return req, nil
 }
 
 // GetImage is a handler to return an image for GET /images/{filename} .
 // If the specified image is not found, it returns the default image.
+// With ?w=, it returns the image resized to the width.
 func (s *Handlers) GetImage(w http.ResponseWriter, r *http.Request) {
 	req, err := parseGetImageRequest(r)
 	if err != nil {
-		slog.Warn("failed to parse get image request: ", "error", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		slog.WarnContext(r.Context(), "failed to parse get image request: ", "error", err)
+		writeError(w, r, validationError(err))
 		return
 	}
 
-	imgPath, err := s.buildImagePath(req.FileName)
+	s.serveImage(w, r, req)
+}
+
+// GetImageThumbnail is a handler to return the thumbnail of an image for GET /images/{filename}/thumb .
+func (s *Handlers) GetImageThumbnail(w http.ResponseWriter, r *http.Request) {
+	req, err := parseGetImageRequest(r)
 	if err != nil {
-		if !errors.Is(err, errImageNotFound) {
-			slog.Warn("failed to build image path: ", "error", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
+		slog.WarnContext(r.Context(), "failed to parse get image request: ", "error", err)
+		writeError(w, r, validationError(err))
+		return
+	}
+	req.Width = thumbnailWidth
+
+	s.serveImage(w, r, req)
+}
 
+// serveImage writes the image requested by GetImage and GetImageThumbnail.
+func (s *Handlers) serveImage(w http.ResponseWriter, r *http.Request, req *GetImageRequest) {
+	ctx := r.Context()
+
+	img, info, err := s.openImage(ctx, req.FileName, req.Width)
+	if errors.Is(err, errImageNotFound) {
 		// when the image is not found, it returns the default image without an error.
-		slog.Info("image not found", "filename", imgPath)
-		imgPath = filepath.Join(s.imgDirPath, "default.jpg")
+		slog.InfoContext(r.Context(), "image not found", "filename", req.FileName)
+		img, info, err = s.openImage(ctx, defaultImageName, req.Width)
+	}
+	if err != nil {
+		if errors.Is(err, errImageNotFound) {
+			writeError(w, r, err)
+			return
+		}
+		slog.ErrorContext(r.Context(), "failed to get image: ", "error", err)
+		writeError(w, r, err)
+		return
 	}
+	defer img.Close()
 
-	slog.Info("returned image", "path", imgPath)
-	http.ServeFile(w, r, imgPath)
+	slog.InfoContext(r.Context(), "returned image", "filename", info.Name)
+	// the content was checked on upload, so the type of the extension is used as is
+	w.Header().Set("Content-Type", imageFormatByName(info.Name).ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// ServeContent handles Range and If-Modified-Since requests
+	http.ServeContent(w, r, info.Name, info.ModTime, img)
 }
 
-// buildImagePath builds the image path and validates it.
-func (s *Handlers) buildImagePath(imageFileName string) (string, error) {
-	imgPath := filepath.Join(s.imgDirPath, filepath.Clean(imageFileName))
+type SearchItemsRequest struct {
+	Keyword string // query parameter "keyword"
+	Limit   int    // query parameter "limit"
+}
 
-	// to prevent directory traversal attacks
-	rel, err := filepath.Rel(s.imgDirPath, imgPath)
-	if err != nil || strings.HasPrefix(rel, "..") {
-		return "", fmt.Errorf("invalid image path: %s", imgPath)
+// parseSearchItemsRequest parses and validates the request to search items.
+func parseSearchItemsRequest(r *http.Request) (*SearchItemsRequest, error) {
+	q := r.URL.Query()
+	req := &SearchItemsRequest{
+		Keyword: strings.TrimSpace(q.Get("keyword")),
+		Limit:   defaultSearchLimit,
 	}
 
-	// validate the image suffix
-	if !strings.HasSuffix(imgPath, ".jpg") && !strings.HasSuffix(imgPath, ".jpeg") {
-		return "", fmt.Errorf("image path does not end with .jpg or .jpeg: %s", imgPath)
+	// validate the request
+	v := &validator{}
+	v.check("keyword", req.Keyword, required, maxLength(maxSearchKeywordLength), singleLine)
+	v.check("limit", q.Get("limit"), intRange(1, maxSearchLimit))
+	if err := v.err(); err != nil {
+		return nil, err
 	}
 
-	// check if the image exists
-	_, err = os.Stat(imgPath)
-	if err != nil {
-		return imgPath, errImageNotFound
+	if limit := q.Get("limit"); limit != "" {
+		req.Limit, _ = strconv.Atoi(limit)
 	}
 
-	return imgPath, nil
+	return req, nil
 }
 
 // SearchItems is a handler to return a list of items for GET /search .
+// The keyword supports `OR`, "phrases" and prefix* searches (see buildMatchQuery),
+// and the items are ordered by relevance.
 func (s *Handlers) SearchItems(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	// STEP 5-2: parse the search query
-	keyword := r.URL.Query().Get("keyword")
-	if keyword == "" {
-		http.Error(w, "keyword is required", http.StatusBadRequest)
+	req, err := parseSearchItemsRequest(r)
+	if err != nil {
+		writeError(w, r, validationError(err))
 		return
 	}
 
 	// STEP 5-2: search items
-	items, err := s.itemRepo.SearchItems(ctx, keyword)
+	// the keyword is normalized in the same way as the indexed text (see normalize.go)
+	keyword := normalizeSearchQuery(req.Keyword)
+	results, err := s.itemRepo.SearchItems(ctx, keyword, req.Limit)
 	if err != nil {
-		slog.Error("failed to get items: ", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if errors.Is(err, errInvalidSearchQuery) {
+			writeError(w, r, err)
+			return
+		}
+		slog.ErrorContext(r.Context(), "failed to get items: ", "error", err)
+		writeError(w, r, err)
 		return
 	}
 
-	if err := json.NewEncoder(w).Encode(items); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := json.NewEncoder(w).Encode(newSearchResultsV1(results)); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
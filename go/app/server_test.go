@@ -1,15 +1,27 @@
 package app
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"go.uber.org/mock/gomock"
@@ -41,6 +53,29 @@ func TestParseAddItemRequest(t *testing.T) {
 				err: false,
 			},
 		},
+		"ok: spaces are trimmed": {
+			args: map[string]string{
+				"name":     " Sample_name\t",
+				"category": "Sample_category ",
+			},
+			wants: wants{
+				req: &AddItemRequest{
+					Name:     "Sample_name",
+					Category: "Sample_category",
+				},
+				err: false,
+			},
+		},
+		"ng: too long name": {
+			args: map[string]string{
+				"name":     strings.Repeat("a", maxItemNameLength+1),
+				"category": "Sample_category",
+			},
+			wants: wants{
+				req: nil,
+				err: true,
+			},
+		},
 		"ng: empty request": {
 			args: map[string]string{},
 			wants: wants{
@@ -68,7 +103,7 @@ func TestParseAddItemRequest(t *testing.T) {
 			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 			// execute test target
-			got, err := parseAddItemRequest(req)
+			got, err := parseAddItemRequest(req, DefaultMaxImageBytes, nil)
 
 			// confirm the result
 			if err != nil {
@@ -84,6 +119,101 @@ func TestParseAddItemRequest(t *testing.T) {
 	}
 }
 
+func TestParseAddItemJSONRequest(t *testing.T) {
+	t.Parallel()
+
+	type wants struct {
+		req    *AddItemRequest
+		images [][]byte
+		err    bool
+	}
+	cases := map[string]struct {
+		contentType string
+		body        string
+		wants
+	}{
+		"ok: image sent as base64": {
+			body: `{"name": " used iPhone 16e ", "category": "phone", "images": [{"data": "aW1hZ2UgYQ=="}, {"id": "0123456789abcdef0123456789abcdef"}]}`,
+			wants: wants{
+				req:    &AddItemRequest{Name: "used iPhone 16e", Category: "phone"},
+				images: [][]byte{[]byte("image a"), nil},
+			},
+		},
+		"ok: without images": {
+			contentType: "application/json; charset=utf-8",
+			body:        `{"name": "used iPhone 16e", "category": "phone", "description": "good condition"}`,
+			wants: wants{
+				req: &AddItemRequest{Name: "used iPhone 16e", Category: "phone", Description: "good condition"},
+			},
+		},
+		"ng: both data and id": {
+			body:  `{"name": "used iPhone 16e", "category": "phone", "images": [{"data": "aW1hZ2UgYQ==", "id": "0123456789abcdef0123456789abcdef"}]}`,
+			wants: wants{err: true},
+		},
+		"ng: invalid upload id": {
+			body:  `{"name": "used iPhone 16e", "category": "phone", "images": [{"id": "b.jpg"}]}`,
+			wants: wants{err: true},
+		},
+		"ng: unknown field": {
+			body:  `{"name": "used iPhone 16e", "category": "phone", "image": "b.jpg"}`,
+			wants: wants{err: true},
+		},
+		"ng: empty request": {
+			body:  `{}`,
+			wants: wants{err: true},
+		},
+		"ng: unsupported content type": {
+			contentType: "text/plain",
+			body:        `name=used iPhone 16e`,
+			wants:       wants{err: true},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest("POST", "/items", strings.NewReader(tt.body))
+			if tt.contentType == "" {
+				tt.contentType = "application/json"
+			}
+			req.Header.Set("Content-Type", tt.contentType)
+
+			got, err := parseAddItemRequest(req, DefaultMaxImageBytes, nil)
+			if err != nil {
+				if !tt.err {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if tt.err {
+				t.Fatalf("expected an error, got %+v", got)
+			}
+			t.Cleanup(func() { removeUploadedImages(t.Context(), got.Images) })
+
+			if len(got.Images) != len(tt.images) {
+				t.Fatalf("expected %d images, got %d", len(tt.images), len(got.Images))
+			}
+			for i, u := range got.Images {
+				if tt.images[i] == nil {
+					continue
+				}
+				data, err := u.ReadAll()
+				if err != nil {
+					t.Fatalf("failed to read image: %v", err)
+				}
+				if !bytes.Equal(data, tt.images[i]) {
+					t.Errorf("expected image %q, got %q", tt.images[i], data)
+				}
+			}
+			got.Images = nil
+			if diff := cmp.Diff(tt.wants.req, got); diff != "" {
+				t.Errorf("unexpected request (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestHelloHandler(t *testing.T) {
 	t.Parallel()
 
@@ -208,107 +338,1068 @@ func TestAddItem(t *testing.T) {
 	}
 }
 
-// STEP 6-4: uncomment this test
-func TestAddItemE2e(t *testing.T) {
-	if testing.Short() {
-		t.Skip("skipping e2e test")
+func TestAddItemJSON(t *testing.T) {
+	t.Parallel()
+
+	const id = "0123456789abcdef0123456789abcdef"
+	cases := map[string]struct {
+		injector func(m *MockItemRepository)
+		code     int
+	}{
+		"ok: an uploaded image is referenced": {
+			injector: func(m *MockItemRepository) {
+				m.EXPECT().GetImageUpload(gomock.Any(), id).Return(&ImageUpload{ID: id, ImageName: "a.jpg"}, nil)
+				m.EXPECT().Insert(gomock.Any(), &Item{Name: "used iPhone 16e", Category: "phone", Images: []string{"a.jpg"}}).Return(nil)
+			},
+			code: http.StatusOK,
+		},
+		"ng: the upload has expired": {
+			injector: func(m *MockItemRepository) {
+				m.EXPECT().GetImageUpload(gomock.Any(), id).Return(nil, errImageUploadNotFound)
+			},
+			code: http.StatusBadRequest,
+		},
 	}
 
-	db, closers, err := setupDB(t)
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+
+			mockIR := NewMockItemRepository(ctrl)
+			tt.injector(mockIR)
+			h := &Handlers{itemRepo: mockIR}
+
+			body := `{"name": "used iPhone 16e", "category": "phone", "images": [{"id": "` + id + `"}]}`
+			req := httptest.NewRequest("POST", "/items", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+
+			rr := httptest.NewRecorder()
+			h.AddItem(rr, req)
+
+			if tt.code != rr.Code {
+				t.Errorf("expected status code %d, got %d: %s", tt.code, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestUploadImage(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewLocalImageStore(t.TempDir())
 	if err != nil {
-		t.Fatalf("failed to set up database: %v", err)
+		t.Fatalf("failed to create image store: %v", err)
 	}
-	t.Cleanup(func() {
-		for _, c := range closers {
-			c()
-		}
+	var b bytes.Buffer
+	if err := png.Encode(&b, image.NewRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatalf("failed to encode image: %v", err)
+	}
+
+	ctrl := gomock.NewController(t)
+	mockIR := NewMockItemRepository(ctrl)
+	var inserted *ImageUpload
+	mockIR.EXPECT().InsertImageUpload(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, upload *ImageUpload) error {
+		inserted = upload
+		return nil
 	})
+	h := &Handlers{images: store, itemRepo: mockIR}
+
+	rr := httptest.NewRecorder()
+	h.UploadImage(rr, newMultipartRequest(t, nil, b.Bytes()))
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	var got ImageUploadV1
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if diff := cmp.Diff(newImageUploadV1(inserted), got); diff != "" {
+		t.Errorf("unexpected response (-want +got):\n%s", diff)
+	}
+	if msg := uploadID(got.ID); msg != "" {
+		t.Errorf("id %s %s", got.ID, msg)
+	}
+	if d := time.Until(got.ExpiresAt); d <= 0 || d > DefaultImageUploadTTL {
+		t.Errorf("unexpected expiration: %v", got.ExpiresAt)
+	}
+	if _, err := store.Stat(t.Context(), got.Image.Name); err != nil {
+		t.Errorf("failed to stat the uploaded image: %v", err)
+	}
+}
+
+func TestUploadImageManyFrames(t *testing.T) {
+	t.Parallel()
+
+	// a GIF whose 4000x4000 frame is repeated 100 times, which is small to upload but huge to decode
+	var b bytes.Buffer
+	frame := image.NewPaletted(image.Rect(0, 0, 4000, 4000), color.Palette{color.Black, color.White})
+	if err := gif.Encode(&b, frame, nil); err != nil {
+		t.Fatalf("failed to encode image: %v", err)
+	}
+	headerLen, err := forEachGIFBlock(b.Bytes(), func(gifBlock) {})
+	if err != nil {
+		t.Fatalf("failed to read image: %v", err)
+	}
+	header, frameBlock := b.Bytes()[:headerLen], b.Bytes()[headerLen:b.Len()-1]
+	data := slices.Concat(header, bytes.Repeat(frameBlock, 100), []byte{0x3b})
+
+	h := &Handlers{itemRepo: NewMockItemRepository(gomock.NewController(t))}
+	rr := httptest.NewRecorder()
+	h.UploadImage(rr, newMultipartRequest(t, nil, data))
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusRequestEntityTooLarge, rr.Code, rr.Body.String())
+	}
+}
+
+func TestGetItem(t *testing.T) {
+	t.Parallel()
+
+	createdAt := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+	cases := map[string]struct {
+		item *Item
+		err  error
+		code int
+		want ItemV1
+	}{
+		"ok: with an image": {
+			item: &Item{ID: 1, Name: "used iPhone 16e", Category: "phone", Images: []string{"a.jpg", "b.png"}, CreatedAt: createdAt, UpdatedAt: createdAt},
+			want: ItemV1{ID: 1, Name: "used iPhone 16e", Category: "phone", ImageURL: "/images/a.jpg", Images: []ImageV1{{Name: "a.jpg", URL: "/images/a.jpg"}, {Name: "b.png", URL: "/images/b.png"}}, CreatedAt: createdAt, UpdatedAt: createdAt},
+		},
+		"ok: without an image": {
+			item: &Item{ID: 2, Name: "white sneakers", Category: "shoes", CreatedAt: createdAt, UpdatedAt: createdAt},
+			want: ItemV1{ID: 2, Name: "white sneakers", Category: "shoes", ImageURL: "/images/default.jpg", Images: []ImageV1{}, CreatedAt: createdAt, UpdatedAt: createdAt},
+		},
+		"ng: not found": {
+			item: &Item{ID: 3},
+			err:  errItemNotFound,
+			code: http.StatusNotFound,
+		},
+		"ng: failed to get": {
+			item: &Item{ID: 4},
+			err:  errors.New("no such table: items"),
+			code: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+
+			id := strconv.Itoa(tt.item.ID)
+			mockIR := NewMockItemRepository(ctrl)
+			if tt.err != nil {
+				mockIR.EXPECT().GetItem(gomock.Any(), id).Return(nil, tt.err)
+			} else {
+				mockIR.EXPECT().GetItem(gomock.Any(), id).Return(tt.item, nil)
+			}
+			h := &Handlers{itemRepo: mockIR}
+
+			req := httptest.NewRequest("GET", "/items/"+id, nil)
+			req.SetPathValue("id", id)
+
+			rr := httptest.NewRecorder()
+			h.GetItem(rr, req)
+
+			if tt.code == 0 {
+				tt.code = http.StatusOK
+			}
+			if rr.Code != tt.code {
+				t.Fatalf("expected status code %d, got %d", tt.code, rr.Code)
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+
+			var got ItemV1
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected response (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// updateItem returns an implementation of ItemRepository.Update for mocks, which applies the update to current
+// and expects the result to be want. It returns errItemNotFound if current is nil.
+func updateItem(t *testing.T, current, want *Item) func(context.Context, string, func(*Item) error) (*Item, error) {
+	return func(_ context.Context, _ string, update func(*Item) error) (*Item, error) {
+		if current == nil {
+			return nil, errItemNotFound
+		}
+		item := *current
+		if err := update(&item); err != nil {
+			return nil, err
+		}
+		if diff := cmp.Diff(want, &item); diff != "" {
+			t.Errorf("unexpected item updated (-want +got):\n%s", diff)
+		}
+		return &item, nil
+	}
+}
+
+func TestUpdateItem(t *testing.T) {
+	t.Parallel()
 
 	type wants struct {
 		code int
 	}
 	cases := map[string]struct {
-		args map[string]string
+		method   string
+		args     map[string]string
+		injector func(m *MockItemRepository)
 		wants
 	}{
-		"ok: correctly inserted": {
+		"ok: replaced by PUT": {
+			method: "PUT",
 			args: map[string]string{
 				"name":     "used iPhone 16e",
 				"category": "phone",
 			},
+			injector: func(m *MockItemRepository) {
+				m.EXPECT().Update(gomock.Any(), "1", gomock.Any()).DoAndReturn(updateItem(t,
+					&Item{ID: 1, Name: "used iPhone 61e", Category: "phone", Images: []string{"a.jpg"}},
+					&Item{ID: 1, Name: "used iPhone 16e", Category: "phone", Images: []string{"a.jpg"}}))
+			},
 			wants: wants{
 				code: http.StatusOK,
 			},
 		},
-		"ng: failed to insert": {
+		"ok: partially updated by PATCH": {
+			method: "PATCH",
 			args: map[string]string{
-				"name":     "",
-				"category": "phone",
+				"category": "smartphone",
+			},
+			injector: func(m *MockItemRepository) {
+				m.EXPECT().Update(gomock.Any(), "1", gomock.Any()).DoAndReturn(updateItem(t,
+					&Item{ID: 1, Name: "used iPhone 16e", Category: "phone"},
+					&Item{ID: 1, Name: "used iPhone 16e", Category: "smartphone"}))
+			},
+			wants: wants{
+				code: http.StatusOK,
+			},
+		},
+		"ng: PUT without category": {
+			method: "PUT",
+			args: map[string]string{
+				"name": "used iPhone 16e",
 			},
+			injector: func(m *MockItemRepository) {},
 			wants: wants{
 				code: http.StatusBadRequest,
 			},
 		},
+		"ng: item not found": {
+			method: "PATCH",
+			args: map[string]string{
+				"name": "used iPhone 16e",
+			},
+			injector: func(m *MockItemRepository) {
+				m.EXPECT().Update(gomock.Any(), "1", gomock.Any()).DoAndReturn(updateItem(t, nil, nil))
+			},
+			wants: wants{
+				code: http.StatusNotFound,
+			},
+		},
 	}
 
 	for name, tt := range cases {
 		t.Run(name, func(t *testing.T) {
-			h := &Handlers{itemRepo: &itemRepository{db: db}}
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+
+			mockIR := NewMockItemRepository(ctrl)
+			tt.injector(mockIR)
+			h := &Handlers{itemRepo: mockIR}
 
 			values := url.Values{}
 			for k, v := range tt.args {
 				values.Set(k, v)
 			}
-			req := httptest.NewRequest("POST", "/items", strings.NewReader(values.Encode()))
+			req := httptest.NewRequest(tt.method, "/items/1", strings.NewReader(values.Encode()))
 			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.SetPathValue("id", "1")
 
 			rr := httptest.NewRecorder()
-			h.AddItem(rr, req)
+			h.UpdateItem(rr, req)
 
-			// check response
 			if tt.wants.code != rr.Code {
 				t.Errorf("expected status code %d, got %d", tt.wants.code, rr.Code)
 			}
 			if tt.wants.code >= 400 {
 				return
 			}
+
 			for _, v := range tt.args {
 				if !strings.Contains(rr.Body.String(), v) {
 					t.Errorf("response body does not contain %s, got: %s", v, rr.Body.String())
 				}
 			}
+		})
+	}
+}
 
-			// STEP 6-4: check inserted data
-			tx, err := db.Begin()
-			if err != nil {
-				t.Fatalf("failed to begin transaction: %v", err)
+func TestParseUpdateItemJSONRequest(t *testing.T) {
+	t.Parallel()
+
+	ptr := func(s string) *string { return &s }
+	type wants struct {
+		req    *UpdateItemRequest
+		images int
+		code   errorCode // the code of the error if any
+	}
+	cases := map[string]struct {
+		method      string
+		contentType string
+		body        string
+		wants
+	}{
+		"ok: replaced by PUT": {
+			method: "PUT",
+			body:   `{"name": " used iPhone 16e ", "category": "phone", "description": "", "images": [{"data": "aW1hZ2UgYQ=="}]}`,
+			wants: wants{
+				req:    &UpdateItemRequest{ID: "1", Name: ptr("used iPhone 16e"), Category: ptr("phone"), Description: ptr("")},
+				images: 1,
+			},
+		},
+		"ok: partially updated by PATCH": {
+			method: "PATCH",
+			body:   `{"name": "used iPhone 16e"}`,
+			wants: wants{
+				req: &UpdateItemRequest{ID: "1", Name: ptr("used iPhone 16e")},
+			},
+		},
+		"ng: PUT without category": {
+			method: "PUT",
+			body:   `{"name": "used iPhone 16e"}`,
+			wants:  wants{code: codeValidation},
+		},
+		"ng: empty name by PATCH": {
+			method: "PATCH",
+			body:   `{"name": " "}`,
+			wants:  wants{code: codeValidation},
+		},
+		"ng: unknown field": {
+			method: "PATCH",
+			body:   `{"title": "used iPhone 16e"}`,
+			wants:  wants{code: codeValidation},
+		},
+		"ng: unsupported content type": {
+			method:      "PATCH",
+			contentType: "text/plain",
+			body:        `name=used iPhone 16e`,
+			wants:       wants{code: codeUnsupportedMedia},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(tt.method, "/items/1", strings.NewReader(tt.body))
+			if tt.contentType == "" {
+				tt.contentType = "application/json"
 			}
+			req.Header.Set("Content-Type", tt.contentType)
+			req.SetPathValue("id", "1")
 
-			var item Item
-			err = tx.QueryRow(`
-				SELECT items.id, items.name, categories.name AS category, items.image_name
-				FROM items 
-				INNER JOIN categories ON items.category_id = categories.id
-				ORDER BY items.id DESC
-				LIMIT 1
-			`).Scan(&item.ID, &item.Name, &item.Category, &item.ImageName)
+			got, err := parseUpdateItemRequest(req, DefaultMaxImageBytes, nil)
 			if err != nil {
-				t.Fatalf("failed to query inserted item: %v", err)
+				if code := newProblem(req, validationError(err)).Code; code != tt.wants.code {
+					t.Errorf("expected code %q, got %q: %v", tt.wants.code, code, err)
+				}
+				return
 			}
-			if item.Name != tt.args["name"] || item.Category != tt.args["category"] {
-				t.Errorf("expected item (name: %s, category: %s), got (name: %s, category: %s)", tt.args["name"], tt.args["category"], item.Name, item.Category)
+			if tt.wants.code != "" {
+				t.Fatalf("expected an error, got %+v", got)
 			}
-			tx.Commit()
+			t.Cleanup(func() { removeUploadedImages(t.Context(), got.Images) })
 
+			if len(got.Images) != tt.wants.images {
+				t.Fatalf("expected %d images, got %d", tt.wants.images, len(got.Images))
+			}
+			got.Images = nil
+			if diff := cmp.Diff(tt.wants.req, got); diff != "" {
+				t.Errorf("unexpected request (-want +got):\n%s", diff)
+			}
 		})
 	}
 }
 
-func setupDB(t *testing.T) (db *sql.DB, closers []func(), e error) {
-	t.Helper()
+func TestUpdateItemImages(t *testing.T) {
+	t.Parallel()
 
-	defer func() {
-		if e != nil {
+	type wants struct {
+		code int
+	}
+	cases := map[string]struct {
+		body     string
+		injector func(m *MockItemRepository)
+		wants
+	}{
+		"ok: reordered and removed": {
+			body: `{"images": ["c.jpg", "a.jpg"]}`,
+			injector: func(m *MockItemRepository) {
+				m.EXPECT().Update(gomock.Any(), "1", gomock.Any()).DoAndReturn(updateItem(t,
+					&Item{ID: 1, Name: "used iPhone 16e", Category: "phone", Images: []string{"a.jpg", "b.jpg", "c.jpg"}},
+					&Item{ID: 1, Name: "used iPhone 16e", Category: "phone", Images: []string{"c.jpg", "a.jpg"}}))
+			},
+			wants: wants{
+				code: http.StatusOK,
+			},
+		},
+		"ng: image of another item": {
+			body: `{"images": ["a.jpg", "d.jpg"]}`,
+			injector: func(m *MockItemRepository) {
+				m.EXPECT().Update(gomock.Any(), "1", gomock.Any()).DoAndReturn(updateItem(t,
+					&Item{ID: 1, Name: "used iPhone 16e", Category: "phone", Images: []string{"a.jpg"}}, nil))
+			},
+			wants: wants{
+				code: http.StatusBadRequest,
+			},
+		},
+		"ng: duplicated image": {
+			body:     `{"images": ["a.jpg", "a.jpg"]}`,
+			injector: func(m *MockItemRepository) {},
+			wants: wants{
+				code: http.StatusBadRequest,
+			},
+		},
+		"ng: item not found": {
+			body: `{"images": []}`,
+			injector: func(m *MockItemRepository) {
+				m.EXPECT().Update(gomock.Any(), "1", gomock.Any()).DoAndReturn(updateItem(t, nil, nil))
+			},
+			wants: wants{
+				code: http.StatusNotFound,
+			},
+		},
+		"ng: unknown field": {
+			body:     `{"images": ["a.jpg"], "name": "x"}`,
+			injector: func(m *MockItemRepository) {},
+			wants: wants{
+				code: http.StatusBadRequest,
+			},
+		},
+		"ng: body too large": {
+			body:     `{"images": ["` + strings.Repeat("a", 64) + `.jpg"]}`,
+			injector: func(m *MockItemRepository) {},
+			wants: wants{
+				code: http.StatusRequestEntityTooLarge,
+			},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+
+			mockIR := NewMockItemRepository(ctrl)
+			tt.injector(mockIR)
+			h := &Handlers{itemRepo: mockIR, maxBodyBytes: 64}
+
+			req := httptest.NewRequest("PUT", "/items/1/images", strings.NewReader(tt.body))
+			req.SetPathValue("id", "1")
+
+			rr := httptest.NewRecorder()
+			h.UpdateItemImages(rr, req)
+
+			if tt.wants.code != rr.Code {
+				t.Errorf("expected status code %d, got %d", tt.wants.code, rr.Code)
+			}
+		})
+	}
+}
+
+func TestDeleteItem(t *testing.T) {
+	t.Parallel()
+
+	type wants struct {
+		code int
+	}
+	cases := map[string]struct {
+		injector func(m *MockItemRepository)
+		wants
+	}{
+		"ok: correctly deleted": {
+			injector: func(m *MockItemRepository) {
+				m.EXPECT().Delete(gomock.Any(), "1").Return(nil)
+			},
+			wants: wants{
+				code: http.StatusNoContent,
+			},
+		},
+		"ng: item not found": {
+			injector: func(m *MockItemRepository) {
+				m.EXPECT().Delete(gomock.Any(), "1").Return(errItemNotFound)
+			},
+			wants: wants{
+				code: http.StatusNotFound,
+			},
+		},
+		"ng: failed to delete": {
+			injector: func(m *MockItemRepository) {
+				m.EXPECT().Delete(gomock.Any(), "1").Return(errors.New("failed to delete"))
+			},
+			wants: wants{
+				code: http.StatusInternalServerError,
+			},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+
+			mockIR := NewMockItemRepository(ctrl)
+			tt.injector(mockIR)
+			h := &Handlers{itemRepo: mockIR}
+
+			req := httptest.NewRequest("DELETE", "/items/1", nil)
+			req.SetPathValue("id", "1")
+
+			rr := httptest.NewRecorder()
+			h.DeleteItem(rr, req)
+
+			if tt.wants.code != rr.Code {
+				t.Errorf("expected status code %d, got %d", tt.wants.code, rr.Code)
+			}
+		})
+	}
+}
+
+func TestGetImage(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewLocalImageStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create image store: %v", err)
+	}
+	for name, image := range map[string]string{"a.jpg": "image a", defaultImageName: "default image"} {
+		if err := store.Put(t.Context(), name, strings.NewReader(image), int64(len(image))); err != nil {
+			t.Fatalf("failed to put image: %v", err)
+		}
+	}
+
+	type wants struct {
+		code int
+		body string
+	}
+	cases := map[string]struct {
+		filename string
+		query    string
+		wants
+	}{
+		"ok: image": {
+			filename: "a.jpg",
+			wants: wants{
+				code: http.StatusOK,
+				body: "image a",
+			},
+		},
+		"ok: default image for a missing image": {
+			filename: "b.jpg",
+			wants: wants{
+				code: http.StatusOK,
+				body: "default image",
+			},
+		},
+		"ng: directory traversal": {
+			filename: "../a.jpg",
+			wants: wants{
+				code: http.StatusBadRequest,
+			},
+		},
+		"ng: not an image": {
+			filename: "a.txt",
+			wants: wants{
+				code: http.StatusBadRequest,
+			},
+		},
+		"ng: width isn't one of the variants": {
+			filename: "a.jpg",
+			query:    "w=123",
+			wants: wants{
+				code: http.StatusBadRequest,
+			},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			h := &Handlers{images: store}
+
+			req := httptest.NewRequest("GET", "/images/x?"+tt.query, nil)
+			req.SetPathValue("filename", tt.filename)
+
+			rr := httptest.NewRecorder()
+			h.GetImage(rr, req)
+
+			if tt.wants.code != rr.Code {
+				t.Errorf("expected status code %d, got %d", tt.wants.code, rr.Code)
+			}
+			if tt.wants.code == http.StatusOK && rr.Body.String() != tt.wants.body {
+				t.Errorf("expected body %q, got %q", tt.wants.body, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetImageThumbnail(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewLocalImageStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create image store: %v", err)
+	}
+	var b bytes.Buffer
+	if err := png.Encode(&b, image.NewRGBA(image.Rect(0, 0, 400, 100))); err != nil {
+		t.Fatalf("failed to encode image: %v", err)
+	}
+	if err := store.Put(t.Context(), "a.png", &b, int64(b.Len())); err != nil {
+		t.Fatalf("failed to put image: %v", err)
+	}
+	h := &Handlers{images: store}
+
+	req := httptest.NewRequest("GET", "/images/a.png/thumb", nil)
+	req.SetPathValue("filename", "a.png")
+	rr := httptest.NewRecorder()
+	h.GetImageThumbnail(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("expected Content-Type image/png, got %s", ct)
+	}
+	cfg, err := png.DecodeConfig(rr.Body)
+	if err != nil {
+		t.Fatalf("failed to decode thumbnail: %v", err)
+	}
+	if cfg.Width != thumbnailWidth || cfg.Height != 50 {
+		t.Errorf("expected %dx50, got %dx%d", thumbnailWidth, cfg.Width, cfg.Height)
+	}
+	// the variant is kept for the next requests
+	if _, err := store.Stat(t.Context(), "a.w200.png"); err != nil {
+		t.Errorf("variant isn't stored: %v", err)
+	}
+}
+
+// STEP 6-4: uncomment this test
+func TestAddItemE2e(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test")
+	}
+
+	db, closers, err := setupDB(t)
+	if err != nil {
+		t.Fatalf("failed to set up database: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, c := range closers {
+			c()
+		}
+	})
+
+	type wants struct {
+		code int
+	}
+	cases := map[string]struct {
+		args map[string]string
+		wants
+	}{
+		"ok: correctly inserted": {
+			args: map[string]string{
+				"name":     "used iPhone 16e",
+				"category": "phone",
+			},
+			wants: wants{
+				code: http.StatusOK,
+			},
+		},
+		"ng: failed to insert": {
+			args: map[string]string{
+				"name":     "",
+				"category": "phone",
+			},
+			wants: wants{
+				code: http.StatusBadRequest,
+			},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			h := &Handlers{itemRepo: &itemRepository{db: db}}
+
+			values := url.Values{}
+			for k, v := range tt.args {
+				values.Set(k, v)
+			}
+			req := httptest.NewRequest("POST", "/items", strings.NewReader(values.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			rr := httptest.NewRecorder()
+			h.AddItem(rr, req)
+
+			// check response
+			if tt.wants.code != rr.Code {
+				t.Errorf("expected status code %d, got %d", tt.wants.code, rr.Code)
+			}
+			if tt.wants.code >= 400 {
+				return
+			}
+			for _, v := range tt.args {
+				if !strings.Contains(rr.Body.String(), v) {
+					t.Errorf("response body does not contain %s, got: %s", v, rr.Body.String())
+				}
+			}
+
+			// STEP 6-4: check inserted data
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatalf("failed to begin transaction: %v", err)
+			}
+
+			var item Item
+			err = tx.QueryRow(`
+				SELECT items.id, items.name, categories.name AS category
+				FROM items 
+				INNER JOIN categories ON items.category_id = categories.id
+				ORDER BY items.id DESC
+				LIMIT 1
+			`).Scan(&item.ID, &item.Name, &item.Category)
+			if err != nil {
+				t.Fatalf("failed to query inserted item: %v", err)
+			}
+			if item.Name != tt.args["name"] || item.Category != tt.args["category"] {
+				t.Errorf("expected item (name: %s, category: %s), got (name: %s, category: %s)", tt.args["name"], tt.args["category"], item.Name, item.Category)
+			}
+			tx.Commit()
+
+		})
+	}
+}
+
+func TestDeleteItemE2e(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test")
+	}
+
+	db, closers, err := setupDB(t)
+	if err != nil {
+		t.Fatalf("failed to set up database: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, c := range closers {
+			c()
+		}
+	})
+
+	repo := &itemRepository{db: db}
+	ctx := t.Context()
+	for _, item := range []*Item{
+		{Name: "used iPhone 16e", Category: "phone"},
+		{Name: "used Pixel 9", Category: "phone"},
+		{Name: "white sneakers", Category: "shoes"},
+	} {
+		if err := repo.Insert(ctx, item); err != nil {
+			t.Fatalf("failed to insert item: %v", err)
+		}
+	}
+
+	countCategories := func() int {
+		var n int
+		if err := db.QueryRow("SELECT COUNT(*) FROM categories").Scan(&n); err != nil {
+			t.Fatalf("failed to count categories: %v", err)
+		}
+		return n
+	}
+
+	h := &Handlers{itemRepo: repo}
+	for _, tt := range []struct {
+		id         string
+		code       int
+		categories int
+	}{
+		{id: "1", code: http.StatusNoContent, categories: 2}, // "phone" still has an item
+		{id: "3", code: http.StatusNoContent, categories: 1}, // "shoes" is removed with its last item
+		{id: "3", code: http.StatusNotFound, categories: 1},
+	} {
+		req := httptest.NewRequest("DELETE", "/items/"+tt.id, nil)
+		req.SetPathValue("id", tt.id)
+		rr := httptest.NewRecorder()
+		h.DeleteItem(rr, req)
+
+		if tt.code != rr.Code {
+			t.Errorf("DELETE /items/%s: expected status code %d, got %d", tt.id, tt.code, rr.Code)
+		}
+		if got := countCategories(); got != tt.categories {
+			t.Errorf("DELETE /items/%s: expected %d categories, got %d", tt.id, tt.categories, got)
+		}
+	}
+}
+
+func TestGetItemsE2e(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test")
+	}
+
+	db, closers, err := setupDB(t)
+	if err != nil {
+		t.Fatalf("failed to set up database: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, c := range closers {
+			c()
+		}
+	})
+
+	repo := &itemRepository{db: db}
+	ctx := t.Context()
+	for _, item := range []*Item{
+		{Name: "b", Category: "phone"},
+		{Name: "d", Category: "phone"},
+		{Name: "a", Category: "shoes"},
+		{Name: "c", Category: "phone"},
+		{Name: "c", Category: "phone"},
+	} {
+		if err := repo.Insert(ctx, item); err != nil {
+			t.Fatalf("failed to insert item: %v", err)
+		}
+	}
+
+	type wants struct {
+		code  int
+		names []string
+		total int
+	}
+	cases := map[string]struct {
+		query string
+		wants
+	}{
+		"ok: default order": {
+			query: "",
+			wants: wants{code: http.StatusOK, names: []string{"b", "d", "a", "c", "c"}, total: 5},
+		},
+		"ok: sorted by name desc": {
+			query: "sort=name&order=desc&limit=2",
+			wants: wants{code: http.StatusOK, names: []string{"d", "c", "c", "b", "a"}, total: 5},
+		},
+		"ok: filtered by category": {
+			query: "category=phone&sort=created_at&limit=3",
+			wants: wants{code: http.StatusOK, names: []string{"b", "d", "c", "c"}, total: 4},
+		},
+		"ng: unknown sort key": {
+			query: "sort=price",
+			wants: wants{code: http.StatusBadRequest},
+		},
+		"ng: broken cursor": {
+			query: "cursor=broken",
+			wants: wants{code: http.StatusBadRequest},
+		},
+	}
+
+	h := &Handlers{itemRepo: repo}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			var names []string
+			query := tt.query
+			for {
+				req := httptest.NewRequest("GET", "/items?"+query, nil)
+				rr := httptest.NewRecorder()
+				h.GetItems(rr, req)
+
+				if tt.wants.code != rr.Code {
+					t.Fatalf("expected status code %d, got %d", tt.wants.code, rr.Code)
+				}
+				if tt.wants.code >= 400 {
+					return
+				}
+
+				var page ItemsV1
+				if err := json.NewDecoder(rr.Body).Decode(&page); err != nil {
+					t.Fatalf("failed to decode response: %v", err)
+				}
+				if page.Total != tt.wants.total {
+					t.Errorf("expected total %d, got %d", tt.wants.total, page.Total)
+				}
+				for _, item := range page.Items {
+					names = append(names, item.Name)
+				}
+				if page.NextCursor == "" {
+					break
+				}
+				values, _ := url.ParseQuery(tt.query)
+				values.Set("cursor", page.NextCursor)
+				query = values.Encode()
+			}
+
+			if diff := cmp.Diff(tt.wants.names, names); diff != "" {
+				t.Errorf("unexpected items (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRunContextE2e(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test")
+	}
+
+	// find a free port
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	_, port, _ := net.SplitHostPort(addr)
+	// uploads are saved in the temporary directory while they're received
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	s := Server{
+		Port:            port,
+		ImageDirPath:    t.TempDir(),
+		DBPath:          filepath.Join(t.TempDir(), "mercari.sqlite3"),
+		ShutdownTimeout: 10 * time.Second,
+	}
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	done := make(chan int, 1)
+	go func() {
+		done <- s.RunContext(ctx)
+	}()
+
+	// wait for the server to be ready
+	for i := 0; ; i++ {
+		res, err := http.Get("http://" + addr + "/readyz")
+		if err == nil {
+			res.Body.Close()
+		}
+		if err == nil && res.StatusCode == http.StatusOK {
+			break
+		}
+		if i == 50 {
+			t.Fatalf("server didn't start: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// the readiness checks above are counted in the metrics
+	res, err := http.Get("http://" + addr + "/metrics")
+	if err != nil {
+		t.Fatalf("failed to get metrics: %v", err)
+	}
+	metrics, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatalf("failed to read metrics: %v", err)
+	}
+	for _, want := range []string{`http_requests_total{code="200",route="GET /readyz"}`, "db_open_connections"} {
+		if !bytes.Contains(metrics, []byte(want)) {
+			t.Errorf("metrics don't contain %s", want)
+		}
+	}
+
+	// start an upload, and stop the server while the body is being sent
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatalf("failed to encode image: %v", err)
+	}
+	form := newMultipartRequest(t, nil, img.Bytes())
+	body, err := io.ReadAll(form.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+	pr, pw := io.Pipe()
+	req, err := http.NewRequest("POST", "http://"+addr+"/images", pr)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Type", form.Header.Get("Content-Type"))
+	type result struct {
+		code int
+		err  error
+	}
+	uploaded := make(chan result, 1)
+	go func() {
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			uploaded <- result{err: err}
+			return
+		}
+		res.Body.Close()
+		uploaded <- result{code: res.StatusCode}
+	}()
+	// send the body up to the middle of the image, and wait for the server to start saving it
+	split := bytes.Index(body, img.Bytes()) + img.Len()/2
+	if _, err := pw.Write(body[:split]); err != nil {
+		t.Fatalf("failed to write body: %v", err)
+	}
+	for i := 0; ; i++ {
+		if files, _ := filepath.Glob(filepath.Join(tmp, "upload-*")); len(files) > 0 {
+			break
+		}
+		if i == 50 {
+			t.Fatal("server didn't receive the upload")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	cancel()
+	// wait until the server stops accepting new connections
+	for i := 0; ; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if i == 50 {
+			t.Fatal("server didn't stop accepting connections")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// the upload in progress is completed
+	if _, err := pw.Write(body[split:]); err != nil {
+		t.Fatalf("failed to write body: %v", err)
+	}
+	pw.Close()
+	if r := <-uploaded; r.err != nil || r.code != http.StatusCreated {
+		t.Errorf("expected status code %d, got %d: %v", http.StatusCreated, r.code, r.err)
+	}
+	select {
+	case code := <-done:
+		if code != 0 {
+			t.Errorf("expected exit code 0, got %d", code)
+		}
+	case <-time.After(s.ShutdownTimeout):
+		t.Error("server didn't stop")
+	}
+}
+
+func setupDB(t *testing.T) (db *sql.DB, closers []func(), e error) {
+	t.Helper()
+
+	defer func() {
+		if e != nil {
 			for _, c := range closers {
 				c()
 			}
@@ -326,7 +1417,7 @@ func setupDB(t *testing.T) (db *sql.DB, closers []func(), e error) {
 	})
 
 	// set up tables
-	db, err = sql.Open("sqlite3", f.Name())
+	db, err = OpenDB(f.Name())
 	if err != nil {
 		return nil, nil, err
 	}
@@ -334,25 +1425,13 @@ func setupDB(t *testing.T) (db *sql.DB, closers []func(), e error) {
 		db.Close()
 	})
 
-	// TODO: replace it with real SQL statements.
-	cmd := `
-	CREATE TABLE IF NOT EXISTS categories (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL UNIQUE
-	);
-
-	CREATE TABLE IF NOT EXISTS items (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL,
-		category_id INTEGER NOT NULL,
-		image_name TEXT NOT NULL,
-		FOREIGN KEY (category_id) REFERENCES categories (id) ON DELETE CASCADE
-	);`
-
-	_, err = db.Exec(cmd)
+	migrator, err := NewMigrator(db)
 	if err != nil {
 		return nil, nil, err
 	}
+	if err := migrator.Up(t.Context()); err != nil {
+		return nil, nil, err
+	}
 
 	return db, closers, nil
 }
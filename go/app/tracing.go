@@ -0,0 +1,213 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// This file traces requests with OpenTelemetry.
+// A request has a span named after its route pattern, e.g. "GET /search", which has the span of the method of
+// Handlers, e.g. "Handlers.SearchItems", and it has the spans of the queries to the ItemRepository,
+// e.g. "ItemRepository.SearchItems". The trace context (W3C traceparent) sent by clients is continued.
+
+// Trace exporters selectable by Server.TraceExporter.
+const (
+	TraceExporterNone   = "none"
+	TraceExporterStdout = "stdout"
+	TraceExporterOTLP   = "otlp"
+)
+
+// DefaultOTLPEndpoint is the default URL of the OpenTelemetry collector receiving spans over OTLP/HTTP.
+const DefaultOTLPEndpoint = "http://localhost:4318"
+
+// serviceName is the name of the server in the traces.
+const serviceName = "mercari-build-training"
+
+// tracerName is the name of the instrumentation of this package.
+const tracerName = "mercari-build-training/app"
+
+// tracePropagator reads and writes the W3C trace context and baggage of requests.
+var tracePropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// newTracerProvider creates the TracerProvider exporting spans to the exporter configured in the server.
+// The returned function flushes the spans and stops the exporter. Nothing is exported for TraceExporterNone.
+func newTracerProvider(ctx context.Context, s Server) (trace.TracerProvider, func(context.Context) error, error) {
+	// for the instrumentations using the global propagator, which continue the trace context even if the spans aren't exported
+	otel.SetTextMapPropagator(tracePropagator)
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch s.TraceExporter {
+	case "", TraceExporterNone:
+		return noop.NewTracerProvider(), func(context.Context) error { return nil }, nil
+	case TraceExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case TraceExporterOTLP:
+		endpoint := s.OTLPEndpoint
+		if endpoint == "" {
+			endpoint = DefaultOTLPEndpoint
+		}
+		exporter, err = otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	default:
+		return nil, nil, fmt.Errorf("unknown trace exporter: %s", s.TraceExporter)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", serviceName)))
+	if err != nil {
+		return nil, nil, err
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	return tp, tp.Shutdown, nil
+}
+
+// untracedPaths are the paths requested periodically by probes and Prometheus, which aren't traced.
+var untracedPaths = []string{"/healthz", "/readyz", "/metrics"}
+
+// tracingMiddleware starts the span of each request, continuing the trace context sent by the client.
+// The span is renamed to the route pattern by traceHandler.
+func tracingMiddleware(next http.Handler, tp trace.TracerProvider) http.Handler {
+	return otelhttp.NewHandler(next, "http.server",
+		otelhttp.WithTracerProvider(tp),
+		// the propagator is passed instead of the global one, which is only set by newTracerProvider
+		otelhttp.WithPropagators(tracePropagator),
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method
+		}),
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			return !slices.Contains(untracedPaths, r.URL.Path)
+		}),
+	)
+}
+
+// traceHandler starts a span named after the method of Handlers, e.g. traceHandler(tp, "GetItems", h.GetItems).
+// next must be registered to the mux, which sets the route pattern to the request.
+func traceHandler(tp trace.TracerProvider, method string, next http.HandlerFunc) http.Handler {
+	tracer := tp.Tracer(tracerName)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the span of the request is named after the route instead of the path, which can contain IDs
+		requestSpan := trace.SpanFromContext(r.Context())
+		requestSpan.SetName(r.Pattern)
+		requestSpan.SetAttributes(attribute.String("http.route", r.Pattern))
+
+		ctx, span := tracer.Start(r.Context(), "Handlers."+method)
+		defer span.End()
+		next(w, r.WithContext(ctx))
+	})
+}
+
+// tracedItemRepository is an ItemRepository starting a span for each query to the repository.
+// Ping, Stats and CloseDB aren't traced, since they aren't called while handling requests.
+type tracedItemRepository struct {
+	ItemRepository
+	tracer trace.Tracer
+}
+
+var _ ItemRepository = (*tracedItemRepository)(nil)
+
+func newTracedItemRepository(repo ItemRepository, tp trace.TracerProvider) ItemRepository {
+	return &tracedItemRepository{ItemRepository: repo, tracer: tp.Tracer(tracerName)}
+}
+
+// start starts the span of a query, which must be ended by endSpan.
+func (r *tracedItemRepository) start(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, attribute.String("db.system", "sqlite"))
+	return r.tracer.Start(ctx, "ItemRepository."+method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// endSpan ends the span of a query, which fails if err isn't nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (r *tracedItemRepository) Insert(ctx context.Context, item *Item) error {
+	ctx, span := r.start(ctx, "Insert")
+	err := r.ItemRepository.Insert(ctx, item)
+	endSpan(span, err)
+	return err
+}
+
+func (r *tracedItemRepository) GetItems(ctx context.Context, query *ItemQuery) (*Items, error) {
+	ctx, span := r.start(ctx, "GetItems", attribute.Int("limit", query.Limit))
+	items, err := r.ItemRepository.GetItems(ctx, query)
+	endSpan(span, err)
+	return items, err
+}
+
+func (r *tracedItemRepository) GetItem(ctx context.Context, id string) (*Item, error) {
+	ctx, span := r.start(ctx, "GetItem", attribute.String("item.id", id))
+	item, err := r.ItemRepository.GetItem(ctx, id)
+	endSpan(span, err)
+	return item, err
+}
+
+func (r *tracedItemRepository) GetImageNames(ctx context.Context) ([]string, error) {
+	ctx, span := r.start(ctx, "GetImageNames")
+	names, err := r.ItemRepository.GetImageNames(ctx)
+	endSpan(span, err)
+	return names, err
+}
+
+func (r *tracedItemRepository) InsertImageUpload(ctx context.Context, upload *ImageUpload) error {
+	ctx, span := r.start(ctx, "InsertImageUpload")
+	err := r.ItemRepository.InsertImageUpload(ctx, upload)
+	endSpan(span, err)
+	return err
+}
+
+func (r *tracedItemRepository) GetImageUpload(ctx context.Context, id string) (*ImageUpload, error) {
+	ctx, span := r.start(ctx, "GetImageUpload")
+	upload, err := r.ItemRepository.GetImageUpload(ctx, id)
+	endSpan(span, err)
+	return upload, err
+}
+
+func (r *tracedItemRepository) DeleteExpiredImageUploads(ctx context.Context, now time.Time) (int64, error) {
+	ctx, span := r.start(ctx, "DeleteExpiredImageUploads")
+	n, err := r.ItemRepository.DeleteExpiredImageUploads(ctx, now)
+	endSpan(span, err)
+	return n, err
+}
+
+func (r *tracedItemRepository) Update(ctx context.Context, id string, update func(item *Item) error) (*Item, error) {
+	ctx, span := r.start(ctx, "Update", attribute.String("item.id", id))
+	item, err := r.ItemRepository.Update(ctx, id, update)
+	endSpan(span, err)
+	return item, err
+}
+
+func (r *tracedItemRepository) Delete(ctx context.Context, id string) error {
+	ctx, span := r.start(ctx, "Delete", attribute.String("item.id", id))
+	err := r.ItemRepository.Delete(ctx, id)
+	endSpan(span, err)
+	return err
+}
+
+func (r *tracedItemRepository) SearchItems(ctx context.Context, keyword string, limit int) (*SearchResults, error) {
+	ctx, span := r.start(ctx, "SearchItems", attribute.Int("limit", limit))
+	results, err := r.ItemRepository.SearchItems(ctx, keyword, limit)
+	endSpan(span, err)
+	return results, err
+}
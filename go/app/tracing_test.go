@@ -0,0 +1,95 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/mock/gomock"
+)
+
+func TestTracing(t *testing.T) {
+	t.Parallel()
+
+	const (
+		traceID      = "0af7651916cd43dd8448eb211c80319c"
+		parentSpanID = "b7ad6b7169203331"
+	)
+
+	cases := map[string]struct {
+		path     string
+		injector func(m *MockItemRepository)
+		// spans are the names of the spans from the innermost one. Each span is the child of the next one.
+		spans  []string
+		status codes.Code
+	}{
+		"ok: a request has the spans of the handler and the queries": {
+			path: "/items/1",
+			injector: func(m *MockItemRepository) {
+				m.EXPECT().GetItem(gomock.Any(), "1").Return(&Item{ID: 1}, nil)
+			},
+			spans:  []string{"ItemRepository.GetItem", "Handlers.GetItem", "GET /items/{id}"},
+			status: codes.Unset,
+		},
+		"ng: a failed query is recorded": {
+			path: "/items/2",
+			injector: func(m *MockItemRepository) {
+				m.EXPECT().GetItem(gomock.Any(), "2").Return(nil, errItemNotFound)
+			},
+			spans:  []string{"ItemRepository.GetItem", "Handlers.GetItem", "GET /items/{id}"},
+			status: codes.Error,
+		},
+		"ok: probes aren't traced": {
+			path:     "/healthz",
+			injector: func(m *MockItemRepository) {},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			sr := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+			ctrl := gomock.NewController(t)
+			mockIR := NewMockItemRepository(ctrl)
+			tt.injector(mockIR)
+			h := &Handlers{itemRepo: newTracedItemRepository(mockIR, tp)}
+
+			mux := http.NewServeMux()
+			mux.Handle("GET /items/{id}", traceHandler(tp, "GetItem", h.GetItem))
+			mux.HandleFunc("GET /healthz", h.Healthz)
+
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("traceparent", "00-"+traceID+"-"+parentSpanID+"-01")
+			tracingMiddleware(mux, tp).ServeHTTP(httptest.NewRecorder(), req)
+
+			spans := sr.Ended()
+			if len(spans) != len(tt.spans) {
+				t.Fatalf("expected %d spans, got %d", len(tt.spans), len(spans))
+			}
+			for i, span := range spans {
+				if span.Name() != tt.spans[i] {
+					t.Errorf("expected span %s, got %s", tt.spans[i], span.Name())
+				}
+				if got := span.SpanContext().TraceID().String(); got != traceID {
+					t.Errorf("expected trace ID %s, got %s", traceID, got)
+				}
+				parent := parentSpanID
+				if i+1 < len(spans) {
+					parent = spans[i+1].SpanContext().SpanID().String()
+				}
+				if got := span.Parent().SpanID().String(); got != parent {
+					t.Errorf("expected parent %s of %s, got %s", parent, span.Name(), got)
+				}
+			}
+			if len(spans) > 0 && spans[0].Status().Code != tt.status {
+				t.Errorf("expected status %v, got %v", tt.status, spans[0].Status().Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// This file reads request bodies with files, such as POST /items .
+// Files are streamed into temporary files while they're uploaded, instead of being kept in memory,
+// and the sizes of the body and the files are limited.
+
+const (
+	// DefaultMaxBodyBytes is the default maximum size of a request body.
+	DefaultMaxBodyBytes = 32 << 20
+	// DefaultMaxImageBytes is the default maximum size of an uploaded image.
+	DefaultMaxImageBytes = 10 << 20
+	// maxFieldBytes is the maximum size of a form field other than files.
+	maxFieldBytes = 64 << 10
+)
+
+// tooLargeError is returned when a request body or a part of it is larger than the limit.
+type tooLargeError struct {
+	// Target is what is too large, such as "request body" and "image".
+	Target string
+	Limit  int64
+}
+
+func (e *tooLargeError) Error() string {
+	return fmt.Sprintf("%s is larger than %d bytes", e.Target, e.Limit)
+}
+
+// uploadedImage is an image sent in a request. It's either a file uploaded and stored in a temporary file,
+// or an image uploaded with POST /images before and referenced by the ID of the upload.
+type uploadedImage struct {
+	path string
+	size int64
+	// sum is the SHA-256 hash of the file computed while it was uploaded.
+	sum []byte
+	// uploadID is the ID of the ImageUpload referenced, which is set instead of path.
+	uploadID string
+}
+
+// ReadAll reads the uploaded image.
+func (u *uploadedImage) ReadAll() ([]byte, error) {
+	return os.ReadFile(u.path)
+}
+
+// removeUploadedImages removes the temporary files of uploaded images.
+func removeUploadedImages(ctx context.Context, images []*uploadedImage) {
+	for _, u := range images {
+		if u.path == "" {
+			continue
+		}
+		if err := os.Remove(u.path); err != nil {
+			slog.WarnContext(ctx, "failed to remove uploaded image", "error", err)
+		}
+	}
+}
+
+// uploadForm is a form read by parseUploadForm.
+type uploadForm struct {
+	Values url.Values
+	// Images are the files sent as `image` parts in order.
+	Images []*uploadedImage
+}
+
+// parseUploadForm reads the form in a request body.
+// multipart/form-data bodies are read part by part, and files in `image` parts are written to temporary files,
+// which the caller must remove with removeUploadedImages. Other bodies are read by http.Request.ParseForm.
+// It returns a *tooLargeError if an image is larger than maxImageBytes or the body is larger than the limit
+// set by http.MaxBytesReader.
+func parseUploadForm(r *http.Request, maxImageBytes int64) (*uploadForm, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		if err := r.ParseForm(); err != nil {
+			return nil, bodyError(r, err)
+		}
+		return &uploadForm{Values: r.PostForm}, nil
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	form := &uploadForm{Values: url.Values{}}
+	// fail removes the images read so far
+	fail := func(err error) (*uploadForm, error) {
+		removeUploadedImages(r.Context(), form.Images)
+		return nil, err
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return form, nil
+		}
+		if err != nil {
+			return fail(bodyError(r, err))
+		}
+
+		name := part.FormName()
+		switch {
+		case name == "":
+			// not a form field
+		case part.FileName() == "":
+			value, err := io.ReadAll(io.LimitReader(part, maxFieldBytes+1))
+			if err != nil {
+				return fail(bodyError(r, err))
+			}
+			if len(value) > maxFieldBytes {
+				return fail(&tooLargeError{Target: name, Limit: maxFieldBytes})
+			}
+			form.Values.Add(name, string(value))
+		case name == "image":
+			if len(form.Images) == maxItemImages {
+				return fail(fmt.Errorf("an item can have up to %d images", maxItemImages))
+			}
+			u, err := saveUploadedImage(part, maxImageBytes)
+			if err != nil {
+				return fail(bodyError(r, err))
+			}
+			form.Images = append(form.Images, u)
+		default:
+			// other files are ignored
+		}
+		part.Close()
+	}
+}
+
+// saveUploadedImage writes an uploaded image to a temporary file, computing its hash at the same time.
+// The errors of reading r are validation errors, and the errors of writing the file are internal errors.
+func saveUploadedImage(r io.Reader, maxBytes int64) (u *uploadedImage, err error) {
+	f, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return nil, internalError(err)
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil && cerr != nil {
+			err = internalError(cerr)
+		}
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+
+	h := sha256.New()
+	src := &sourceReader{r: io.LimitReader(r, maxBytes+1)}
+	n, err := io.Copy(io.MultiWriter(f, h), src)
+	if err != nil {
+		if src.err != nil {
+			return nil, validationError(src.err)
+		}
+		return nil, internalError(err)
+	}
+	if n > maxBytes {
+		return nil, &tooLargeError{Target: "image", Limit: maxBytes}
+	}
+	return &uploadedImage{path: f.Name(), size: n, sum: h.Sum(nil)}, nil
+}
+
+// sourceReader keeps the error of reading r other than io.EOF,
+// which tells the errors of reading a request apart from the errors of writing it.
+type sourceReader struct {
+	r   io.Reader
+	err error
+}
+
+func (s *sourceReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		s.err = err
+	}
+	return n, err
+}
+
+// bodyError converts the error of reading a body limited by http.MaxBytesReader into a *tooLargeError.
+func bodyError(r *http.Request, err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return &tooLargeError{Target: "request body", Limit: maxBytesErr.Limit}
+	}
+	// the multipart reader doesn't wrap the error when the limit is hit while reading headers,
+	// but the body keeps returning the error after hitting the limit
+	if _, rerr := r.Body.Read(make([]byte, 1)); errors.As(rerr, &maxBytesErr) {
+		return &tooLargeError{Target: "request body", Limit: maxBytesErr.Limit}
+	}
+	return err
+}
@@ -0,0 +1,172 @@
+package app
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// newMultipartRequest creates a POST /items request with the fields and the images as `image` parts.
+func newMultipartRequest(t *testing.T, fields map[string]string, images ...[]byte) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range fields {
+		if err := mw.WriteField(k, v); err != nil {
+			t.Fatalf("failed to write field: %v", err)
+		}
+	}
+	for _, image := range images {
+		fw, err := mw.CreateFormFile("image", "image.jpg")
+		if err != nil {
+			t.Fatalf("failed to create form file: %v", err)
+		}
+		fw.Write(image)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatalf("failed to close multipart writer: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/items", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestParseUploadForm(t *testing.T) {
+	t.Parallel()
+
+	type wants struct {
+		images   int
+		tooLarge string // the target of the *tooLargeError if any
+	}
+	cases := map[string]struct {
+		images       [][]byte
+		maxBodyBytes int64
+		wants
+	}{
+		"ok: images": {
+			images: [][]byte{[]byte("first image"), []byte("second image")},
+			wants:  wants{images: 2},
+		},
+		"ok: no image": {
+			wants: wants{images: 0},
+		},
+		"ng: image too large": {
+			images: [][]byte{bytes.Repeat([]byte("x"), 101)},
+			wants:  wants{tooLarge: "image"},
+		},
+		"ng: body too large": {
+			images:       [][]byte{[]byte("first image"), []byte("second image")},
+			maxBodyBytes: 200,
+			wants:        wants{tooLarge: "request body"},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			req := newMultipartRequest(t, map[string]string{"name": "used iPhone 16e"}, tt.images...)
+			if tt.maxBodyBytes > 0 {
+				req.Body = http.MaxBytesReader(httptest.NewRecorder(), req.Body, tt.maxBodyBytes)
+			}
+
+			form, err := parseUploadForm(req, 100)
+			if tt.wants.tooLarge != "" {
+				var tooLarge *tooLargeError
+				if !errors.As(err, &tooLarge) || tooLarge.Target != tt.wants.tooLarge {
+					t.Fatalf("expected tooLargeError of %s, got %v", tt.wants.tooLarge, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer removeUploadedImages(t.Context(), form.Images)
+
+			if got := form.Values.Get("name"); got != "used iPhone 16e" {
+				t.Errorf("expected name %q, got %q", "used iPhone 16e", got)
+			}
+			if len(form.Images) != tt.wants.images {
+				t.Fatalf("expected %d images, got %d", tt.wants.images, len(form.Images))
+			}
+			for i, u := range form.Images {
+				got, err := os.ReadFile(u.path)
+				if err != nil {
+					t.Fatalf("failed to read uploaded image: %v", err)
+				}
+				sum := sha256.Sum256(tt.images[i])
+				if !bytes.Equal(got, tt.images[i]) || !bytes.Equal(u.sum, sum[:]) {
+					t.Errorf("unexpected uploaded image %d: %q", i, got)
+				}
+			}
+		})
+	}
+}
+
+func TestAddItemTooLarge(t *testing.T) {
+	t.Parallel()
+
+	h := &Handlers{maxImageBytes: 100}
+	req := newMultipartRequest(t, map[string]string{"name": "used iPhone 16e", "category": "phone"}, bytes.Repeat([]byte("x"), 101))
+	rr := httptest.NewRecorder()
+	h.AddItem(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected status code %d, got %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+	var body Problem
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode error: %v", err)
+	}
+	if body.Code != codePayloadTooLarge || body.Target != "image" || body.LimitBytes != 100 {
+		t.Errorf("unexpected error: %+v", body)
+	}
+}
+
+func TestSaveUploadedImageErrors(t *testing.T) {
+	cases := map[string]struct {
+		body   io.Reader
+		tmpDir string
+		code   errorCode
+	}{
+		"ng: broken body": {
+			body: iotest.ErrReader(io.ErrUnexpectedEOF),
+			code: codeValidation,
+		},
+		"ng: temporary directory unavailable": {
+			body:   strings.NewReader("image"),
+			tmpDir: "/nonexistent",
+			code:   codeInternal,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			// TMPDIR is set for the whole process, so the cases aren't run in parallel
+			if tt.tmpDir != "" {
+				t.Setenv("TMPDIR", tt.tmpDir)
+			}
+
+			u, err := saveUploadedImage(tt.body, 100)
+			if err == nil {
+				removeUploadedImages(t.Context(), []*uploadedImage{u})
+				t.Fatal("expected an error")
+			}
+			req := httptest.NewRequest("POST", "/images", nil)
+			if got := newProblem(req, validationError(err)).Code; got != tt.code {
+				t.Errorf("expected code %s, got %s: %v", tt.code, got, err)
+			}
+		})
+	}
+}
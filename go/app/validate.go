@@ -0,0 +1,154 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// This file validates the fields of requests with declarative rules.
+// A validator checks every field and collects all the failures, so that clients can show them at once.
+//
+//	v := &validator{}
+//	v.check("name", req.Name, required, maxLength(maxItemNameLength), singleLine)
+//	v.check("limit", q.Get("limit"), intRange(1, maxItemsLimit))
+//	if err := v.err(); err != nil { ... }
+
+// The limits of the fields of requests.
+const (
+	maxItemNameLength        = 100
+	maxItemCategoryLength    = 50
+	maxItemDescriptionLength = 1000
+	maxSearchKeywordLength   = 100
+)
+
+// FieldError is a failure of the validation of a field.
+type FieldError struct {
+	// Field is the name of the field, such as "name" and "limit".
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// fieldErrors is the error of a request with invalid fields, which is returned to clients as a validation error.
+type fieldErrors []FieldError
+
+func (e fieldErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// rule checks a value and returns the message of the failure, or "" if the value is valid.
+// Rules other than required accept an empty value, so that they can be used for optional fields.
+type rule func(value string) string
+
+// required rejects an empty value.
+func required(value string) string {
+	if value == "" {
+		return "is required"
+	}
+	return ""
+}
+
+// maxLength rejects a value longer than n characters.
+func maxLength(n int) rule {
+	return func(value string) string {
+		if utf8.RuneCountInString(value) > n {
+			return fmt.Sprintf("must be at most %d characters", n)
+		}
+		return ""
+	}
+}
+
+// singleLine rejects a value with control characters including line breaks.
+func singleLine(value string) string {
+	if strings.ContainsFunc(value, unicode.IsControl) {
+		return "must not contain control characters"
+	}
+	return ""
+}
+
+// multiLine rejects a value with control characters other than line breaks and tabs.
+func multiLine(value string) string {
+	if strings.ContainsFunc(value, func(r rune) bool {
+		return unicode.IsControl(r) && r != '\n' && r != '\r' && r != '\t'
+	}) {
+		return "must not contain control characters"
+	}
+	return ""
+}
+
+// oneOf rejects a value not in values. It accepts any value if values is empty.
+func oneOf(values ...string) rule {
+	return func(value string) string {
+		if value == "" || len(values) == 0 {
+			return ""
+		}
+		for _, v := range values {
+			if value == v {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(values, ", ")
+	}
+}
+
+// intRange rejects a value which isn't an integer between min and max.
+func intRange(min, max int) rule {
+	return func(value string) string {
+		if value == "" {
+			return ""
+		}
+		if n, err := strconv.Atoi(value); err != nil || n < min || n > max {
+			return fmt.Sprintf("must be an integer between %d and %d", min, max)
+		}
+		return ""
+	}
+}
+
+// positiveInt rejects a value which isn't a positive integer, such as IDs.
+func positiveInt(value string) string {
+	if value == "" {
+		return ""
+	}
+	if n, err := strconv.Atoi(value); err != nil || n < 1 {
+		return "must be a positive integer"
+	}
+	return ""
+}
+
+// validator checks fields with rules and collects the failures.
+type validator struct {
+	errs fieldErrors
+}
+
+// check checks a field with rules in order, and records the first failure.
+func (v *validator) check(field, value string, rules ...rule) {
+	for _, r := range rules {
+		if msg := r(value); msg != "" {
+			v.add(field, msg)
+			return
+		}
+	}
+}
+
+// add records a failure of a field.
+func (v *validator) add(field, message string) {
+	v.errs = append(v.errs, FieldError{Field: field, Message: message})
+}
+
+// err returns the failures as a fieldErrors, or nil if all the fields are valid.
+func (v *validator) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
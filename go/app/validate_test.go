@@ -0,0 +1,71 @@
+package app
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValidator(t *testing.T) {
+	t.Parallel()
+
+	type fields struct {
+		name, category, description, limit string
+	}
+	cases := map[string]struct {
+		fields fields
+		want   []FieldError
+	}{
+		"ok: valid fields": {
+			fields: fields{name: "used iPhone 16e", category: "phone", description: "good\ncondition", limit: "10"},
+		},
+		"ok: optional fields are empty": {
+			fields: fields{name: "used iPhone 16e", category: "phone"},
+		},
+		"ng: every failing field is reported": {
+			fields: fields{category: "food", description: strings.Repeat("あ", maxItemDescriptionLength+1), limit: "0"},
+			want: []FieldError{
+				{Field: "name", Message: "is required"},
+				{Field: "category", Message: "must be one of phone, shoes"},
+				{Field: "description", Message: "must be at most 1000 characters"},
+				{Field: "limit", Message: "must be an integer between 1 and 100"},
+			},
+		},
+		"ng: control characters": {
+			fields: fields{name: "used\niPhone", category: "phone", description: "good\x00"},
+			want: []FieldError{
+				{Field: "name", Message: "must not contain control characters"},
+				{Field: "description", Message: "must not contain control characters"},
+			},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			v := &validator{}
+			v.check("name", tt.fields.name, required, maxLength(maxItemNameLength), singleLine)
+			v.check("category", tt.fields.category, required, oneOf("phone", "shoes"))
+			v.check("description", tt.fields.description, maxLength(maxItemDescriptionLength), multiLine)
+			v.check("limit", tt.fields.limit, intRange(1, 100))
+			err := v.err()
+
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			var got fieldErrors
+			if !errors.As(err, &got) {
+				t.Fatalf("expected fieldErrors, got %v", err)
+			}
+			if diff := cmp.Diff(tt.want, []FieldError(got)); diff != "" {
+				t.Errorf("unexpected errors (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
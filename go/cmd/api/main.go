@@ -1,22 +1,32 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"mercari-build-training/app"
 	"os"
 )
 
-const (
-	port         = "9000"
-	imageDirPath = "images"
-	dbPath       = "db/mercari.sqlite3"
-)
-
 func main() {
 	// This is the entry point of the application.
-	// You don't need to modify this function.
-	os.Exit(app.Server{
-		Port:         port,
-		ImageDirPath: imageDirPath,
-		DBPath:       dbPath,
-	}.Run())
+	// The settings are read from the flags, the environment variables and the config file (see app.LoadConfig).
+	cfg, opts, err := app.LoadConfig(os.Args[0], os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if opts.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	os.Exit(cfg.Server().Run())
 }
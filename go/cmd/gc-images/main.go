@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"mercari-build-training/app"
+	"os"
+)
+
+const (
+	defaultDBPath       = "db/mercari.sqlite3"
+	defaultImageDirPath = "images"
+)
+
+const usage = `Usage: gc-images [flags]
+
+Removes the images which aren't referenced by any item.
+The images are read from -images, or from the S3-compatible storage configured by
+the S3_* environment variables if IMAGE_BACKEND=s3 .
+
+Flags:
+`
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	fs := flag.NewFlagSet("gc-images", flag.ContinueOnError)
+	dbPath := fs.String("db", defaultDBPath, "path to the SQLite database file")
+	imageDirPath := fs.String("images", defaultImageDirPath, "path to the directory storing images")
+	dryRun := fs.Bool("dry-run", false, "only print the images to remove")
+	grace := fs.Duration("grace", app.DefaultImageGCGrace, "keep the images stored within this duration")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx := context.Background()
+	db, err := app.OpenDB(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open database: %v\n", err)
+		return 1
+	}
+	itemRepo := app.NewItemRepositoryFromDB(db)
+	defer itemRepo.CloseDB()
+
+	// the database isn't migrated by this command, so its schema must be the one this command knows
+	migrator, err := app.NewMigrator(db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load migrations: %v\n", err)
+		return 1
+	}
+	if err := migrator.CheckLatest(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "%v (run `migrate up` or use the gc-images of the same version as the server)\n", err)
+		return 1
+	}
+
+	images, err := app.NewImageStore(ctx, app.Server{
+		ImageDirPath: *imageDirPath,
+		ImageBackend: os.Getenv("IMAGE_BACKEND"),
+		S3:           app.S3ConfigFromEnv(),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open image store: %v\n", err)
+		return 1
+	}
+
+	result, err := app.CollectImages(ctx, itemRepo, images, app.ImageGCOptions{Grace: *grace, DryRun: *dryRun})
+	if result != nil {
+		var size int64
+		for _, info := range result.Removed {
+			fmt.Println(info.Name)
+			size += info.Size
+		}
+		verb := "removed"
+		if *dryRun {
+			verb = "would remove"
+		}
+		fmt.Fprintf(os.Stderr, "%s %d images (%d bytes), kept %d images, deleted %d expired uploads\n", verb, len(result.Removed), size, result.Kept, result.ExpiredUploads)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to collect images: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"mercari-build-training/app"
+	"os"
+	"strconv"
+)
+
+const defaultDBPath = "db/mercari.sqlite3"
+
+const usage = `Usage: migrate [-db path] <command>
+
+Commands:
+  up                   apply all the pending migrations
+  down                 roll back the latest applied migration
+  status               show the applied and pending migrations
+  to-version VERSION   migrate up or down to VERSION (0 rolls back everything)
+
+Flags:
+`
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dbPath := fs.String("db", defaultDBPath, "path to the SQLite database file")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	db, err := app.OpenDB(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	migrator, err := app.NewMigrator(db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load migrations: %v\n", err)
+		return 1
+	}
+
+	ctx := context.Background()
+	switch cmd := fs.Arg(0); cmd {
+	case "up":
+		err = migrator.Up(ctx)
+	case "down":
+		err = migrator.Down(ctx)
+	case "to-version":
+		if fs.NArg() != 2 {
+			fs.Usage()
+			return 2
+		}
+		version, convErr := strconv.Atoi(fs.Arg(1))
+		if convErr != nil {
+			fmt.Fprintf(os.Stderr, "invalid version: %s\n", fs.Arg(1))
+			return 2
+		}
+		err = migrator.To(ctx, version)
+	case "status":
+		err = printStatus(ctx, migrator)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", cmd)
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migration failed: %v\n", err)
+		return 1
+	}
+
+	if cmd := fs.Arg(0); cmd != "status" {
+		version, err := migrator.Version(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to get the schema version: %v\n", err)
+			return 1
+		}
+		fmt.Printf("schema is at version %d\n", version)
+	}
+	return 0
+}
+
+func printStatus(ctx context.Context, migrator *app.Migrator) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range statuses {
+		state := "pending"
+		if !s.AppliedAt.IsZero() {
+			state = "applied at " + s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%04d  %-30s  %s\n", s.Version, s.Name, state)
+	}
+	return nil
+}
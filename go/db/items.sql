@@ -1,12 +0,0 @@
-CREATE TABLE categories (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL UNIQUE
-	);
-CREATE TABLE sqlite_sequence(name,seq);
-CREATE TABLE items (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL,
-		category_id INTEGER NOT NULL,
-		image_name TEXT NOT NULL,
-		FOREIGN KEY (category_id) REFERENCES categories (id) ON DELETE CASCADE
-	);
@@ -1,18 +1,45 @@
 const SERVER_URL = import.meta.env.VITE_BACKEND_URL || 'http://127.0.0.1:9000';
 
+export interface ItemImage {
+  name: string;
+  url: string;
+}
+
 export interface Item {
   id: number;
   name: string;
   category: string;
-  image_name: string;
+  description: string;
+  image_url: string;
+  images: ItemImage[];
+  created_at: string;
+  updated_at: string;
 }
 
 export interface ItemListResponse {
   items: Item[];
+  next_cursor?: string;
+  total: number;
 }
 
-export const fetchItems = async (): Promise<ItemListResponse> => {
-  const response = await fetch(`${SERVER_URL}/items`, {
+export interface FetchItemsParams {
+  limit?: number;
+  cursor?: string;
+  sort?: 'id' | 'name' | 'created_at';
+  order?: 'asc' | 'desc';
+  category?: string;
+}
+
+export const fetchItems = async (
+  params: FetchItemsParams = {},
+): Promise<ItemListResponse> => {
+  const query = new URLSearchParams();
+  Object.entries(params).forEach(([key, value]) => {
+    if (value !== undefined && value !== '') {
+      query.set(key, String(value));
+    }
+  });
+  const response = await fetch(`${SERVER_URL}/items?${query.toString()}`, {
     method: 'GET',
     mode: 'cors',
     headers: {
@@ -4,12 +4,13 @@ import { Item, fetchItems } from '~/api';
 const PLACEHOLDER_IMAGE = import.meta.env.VITE_FRONTEND_URL + '/logo192.png';
 
 // Get image URL
-const getImageURL = (imageName: string) => {
+const getImageURL = (imageURL: string) => {
   // if there is no image, return placeholder image
-  if (!imageName) {
+  if (!imageURL) {
     return PLACEHOLDER_IMAGE;
   }
-  return import.meta.env.VITE_BACKEND_URL + '/images/' + imageName;
+  // the list shows the thumbnail instead of the original image
+  return import.meta.env.VITE_BACKEND_URL + imageURL + '/thumb';
 }
 
 
@@ -18,14 +19,18 @@ interface Prop {
   onLoadCompleted: () => void;
 }
 
+const PAGE_SIZE = 20;
+
 export const ItemList = ({ reload, onLoadCompleted }: Prop) => {
   const [items, setItems] = useState<Item[]>([]);
+  const [nextCursor, setNextCursor] = useState<string | undefined>();
   useEffect(() => {
     const fetchData = () => {
-      fetchItems()
+      fetchItems({ limit: PAGE_SIZE, sort: 'created_at', order: 'desc' })
         .then((data) => {
           console.debug('GET success:', data);
           setItems(data.items);
+          setNextCursor(data.next_cursor);
           onLoadCompleted();
         })
         .catch((error) => {
@@ -38,13 +43,30 @@ export const ItemList = ({ reload, onLoadCompleted }: Prop) => {
     }
   }, [reload, onLoadCompleted]);
 
+  const loadMore = () => {
+    fetchItems({
+      limit: PAGE_SIZE,
+      sort: 'created_at',
+      order: 'desc',
+      cursor: nextCursor,
+    })
+      .then((data) => {
+        console.debug('GET success:', data);
+        setItems((prev) => [...prev, ...data.items]);
+        setNextCursor(data.next_cursor);
+      })
+      .catch((error) => {
+        console.error('GET error:', error);
+      });
+  };
+
   return (
     <div className="ItemGrid">
       {items.map((item) => {
         return (
           <div key={item.id} className="ItemList">
             {/* TODO: Task 2: Show item images */}
-            <img src={getImageURL(item.image_name)}
+            <img src={getImageURL(item.image_url)}
             className="Image" />
             <p>
               <span>Name: {item.name}</span>
@@ -54,6 +76,11 @@ export const ItemList = ({ reload, onLoadCompleted }: Prop) => {
           </div>
         );
       })}
+      {nextCursor && (
+        <button type="button" onClick={loadMore}>
+          Load more
+        </button>
+      )}
     </div>
   );
 };